@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+	"gopkg.in/yaml.v3"
+)
+
+// manifest describes the stacks of an environment for apply.
+type manifest struct {
+	Region string                    `yaml:"region"`
+	Tags   yaml.Node                 `yaml:"tags"`
+	Stacks map[string]*manifestStack `yaml:"stacks"`
+
+	dir     string
+	waves   [][]string // stacks in dependency order, each wave only depends on earlier waves
+	preview string     // suffix of the preview copies of the stacks, see mk -preview
+}
+
+// manifestStack is a stack in a manifest, its fields match the mk flags.
+type manifestStack struct {
+	Template    string    `yaml:"template"`
+	Params      yaml.Node `yaml:"params"`
+	ParamsFiles []string  `yaml:"paramsFiles"`
+	Tags        yaml.Node `yaml:"tags"`
+	TagsFile    string    `yaml:"tagsFile"`
+	Render      []string  `yaml:"render"`
+	Region      string    `yaml:"region"`
+	DependsOn   []string  `yaml:"dependsOn"`
+	Caps        string    `yaml:"caps"`
+	Role        string    `yaml:"role"`
+	Protect     bool      `yaml:"protect"`
+	Policy      string    `yaml:"policy"`
+
+	params map[string]string
+	tags   map[string]string
+}
+
+func (s stack) apply(args []string, plan, lint bool, wait string, parallel int, preview string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "apply accepts one positional argument, the manifest")
+		fmt.Print(usageApply)
+		return 64
+	}
+	m, err := loadManifest(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 66
+	}
+	if err := s.infer(m); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 65
+	}
+	if preview != "" {
+		if m.preview = previewSuffix(preview); m.preview == "" {
+			fmt.Fprintf(os.Stderr, "cant use '%s' as a preview suffix, it needs letters or numbers\n", preview)
+			return 64
+		}
+	}
+
+	for i, wave := range m.waves {
+		for _, name := range wave {
+			ms := m.Stacks[name]
+			deps := "-"
+			if len(ms.DependsOn) > 0 {
+				dd := []string{}
+				for _, dep := range ms.DependsOn {
+					dd = append(dd, m.stackName(dep))
+				}
+				deps = strings.Join(dd, ",")
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\n", i+1, m.stackName(name), m.region(ms, s), ms.Template, deps)
+		}
+	}
+	if plan {
+		return 0
+	}
+
+	if wait == "" {
+		wait = "events"
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+	ec := 0
+	for _, r := range s.run(m, parallel, lint, wait) {
+		fmt.Printf("%s\t%s\t%s\n", m.stackName(r.name), r.outcome, r.dur.Round(time.Second))
+		if r.outcome != "ok" {
+			ec = 1
+		}
+	}
+	return ec
+}
+
+// applyResult is the outcome of applying a stack.
+type applyResult struct {
+	name    string
+	outcome string // ok, failed (exit n), skipped
+	dur     time.Duration
+}
+
+// run applies the stacks in the manifest, up to parallel at a time, as soon
+// as the stacks they depend on are done. Stacks which depend on a stack
+// which failed are skipped. The results are in plan order.
+func (s stack) run(m *manifest, parallel int, lint bool, wait string) []applyResult {
+	order := []string{}
+	width := 0
+	for _, wave := range m.waves {
+		order = append(order, wave...)
+		for _, name := range wave {
+			if len(m.stackName(name)) > width {
+				width = len(m.stackName(name))
+			}
+		}
+	}
+
+	mu := &sync.Mutex{} // keeps lines from parallel stacks whole
+	results := map[string]applyResult{}
+	started := map[string]bool{}
+	done := make(chan applyResult)
+	running := 0
+	for len(results) < len(order) {
+		// order is topological, so a skip reaches every dependant in one pass
+		for _, name := range order {
+			if _, ok := results[name]; ok || started[name] {
+				continue
+			}
+			ready, failed := true, false
+			for _, dep := range m.Stacks[name].DependsOn {
+				r, ok := results[dep]
+				ready = ready && ok
+				failed = failed || (ok && r.outcome != "ok")
+			}
+			if failed {
+				results[name] = applyResult{name: name, outcome: "skipped"}
+				continue
+			}
+			if !ready || running >= parallel {
+				continue
+			}
+
+			started[name] = true
+			running++
+			x := s.inRegion(m.Stacks[name].Region)
+			var out, err *prefixWriter
+			if parallel > 1 {
+				prefix := fmt.Sprintf("%-*s | ", width, m.stackName(name))
+				out = &prefixWriter{mu: mu, w: os.Stdout, prefix: prefix}
+				err = &prefixWriter{mu: mu, w: os.Stderr, prefix: prefix}
+				x.out, x.err = out, err
+			}
+			go func(name string, x stack) {
+				t := time.Now()
+				fmt.Fprintf(x.stderr(), "applying '%s'\n", m.stackName(name))
+				r := applyResult{name: name, outcome: "ok"}
+				opts := m.makeOpts(m.Stacks[name], lint, wait)
+				pv, perr := x.stackOutputs(m, opts.paramValues)
+				opts.paramValues = pv
+				if perr != nil {
+					fmt.Fprintf(x.stderr(), "%v\n", perr)
+					r.outcome = "failed (exit 1)"
+				} else if ec := x.make([]string{name}, opts); ec != 0 {
+					r.outcome = fmt.Sprintf("failed (exit %d)", ec)
+				}
+				r.dur = time.Since(t)
+				if out != nil {
+					out.Flush()
+					err.Flush()
+				}
+				done <- r
+			}(name, x)
+		}
+		if running == 0 {
+			break
+		}
+		r := <-done
+		running--
+		results[r.name] = r
+	}
+
+	rr := []applyResult{}
+	for _, name := range order {
+		rr = append(rr, results[name])
+	}
+	return rr
+}
+
+// prefixWriter writes each line with a prefix. Writers sharing a mutex can
+// be used concurrently without their lines being interleaved.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		p.mu.Lock()
+		fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf[:i])
+		p.mu.Unlock()
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes any partial line, e.g. progress dots.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		_, _ = p.Write([]byte("\n"))
+	}
+}
+
+// loadManifest reads the manifest. Paths in the manifest are relative to it.
+func loadManifest(fn string) (*manifest, error) {
+	b, err := os.ReadFile(filepath.Clean(fn))
+	if err != nil {
+		return nil, fmt.Errorf("cant read manifest: %w", err)
+	}
+	m := &manifest{dir: filepath.Dir(fn)}
+	if err := yaml.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("cant unmarshal manifest: %w", err)
+	}
+	if len(m.Stacks) < 1 {
+		return nil, fmt.Errorf("manifest '%s' has no stacks", fn)
+	}
+
+	tags, err := nodeMap(&m.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("tags: %w", err)
+	}
+	for name, ms := range m.Stacks {
+		if ms == nil || ms.Template == "" {
+			return nil, fmt.Errorf("stack '%s' has no template", name)
+		}
+		if ms.params, err = nodeMap(&ms.Params); err != nil {
+			return nil, fmt.Errorf("stack '%s' params: %w", name, err)
+		}
+		st, err := nodeMap(&ms.Tags)
+		if err != nil {
+			return nil, fmt.Errorf("stack '%s' tags: %w", name, err)
+		}
+		ms.tags = map[string]string{}
+		for k, v := range tags {
+			ms.tags[k] = v
+		}
+		for k, v := range st {
+			ms.tags[k] = v
+		}
+		if ms.Region == "" {
+			ms.Region = m.Region
+		}
+		for _, dep := range ms.DependsOn {
+			if _, ok := m.Stacks[dep]; !ok {
+				return nil, fmt.Errorf("stack '%s' depends on '%s' which is not in the manifest", name, dep)
+			}
+		}
+	}
+	return m, nil
+}
+
+// infer adds the dependencies between stacks which their templates and
+// params imply, then orders the stacks. A stack depends on the stack which
+// exports a name it imports with Fn::ImportValue, and on the stack named by
+// a stack:<name>.<output> param.
+func (s stack) infer(m *manifest) error {
+	names := []string{}
+	for name := range m.Stacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	exporters := map[string]string{} // region/export: stack
+	imports := map[string][]string{} // stack: region/export
+	for _, name := range names {
+		ms := m.Stacks[name]
+		region := m.region(ms, s)
+		d, vars, err := s.inRegion(ms.Region).manifestTemplate(m, name)
+		if err != nil {
+			return err
+		}
+		for _, e := range d.Exports(vars) {
+			key := region + "/" + e
+			if prev, ok := exporters[key]; ok {
+				return fmt.Errorf("stacks '%s' and '%s' both export '%s'", prev, name, e)
+			}
+			exporters[key] = name
+		}
+		for _, i := range d.Imports(vars) {
+			imports[name] = append(imports[name], region+"/"+i)
+		}
+	}
+
+	for _, name := range names {
+		ms := m.Stacks[name]
+		deps := []string{}
+		for _, i := range imports[name] {
+			deps = append(deps, exporters[i])
+		}
+		for _, v := range ms.params {
+			if ref, _, ok := stackRef(v); ok {
+				deps = append(deps, ref)
+			}
+		}
+		for _, dep := range deps {
+			if _, ok := m.Stacks[dep]; ok && dep != name && !slices.Contains(ms.DependsOn, dep) {
+				ms.DependsOn = append(ms.DependsOn, dep)
+			}
+		}
+		sort.Strings(ms.DependsOn)
+	}
+
+	deps := map[string][]string{}
+	for name, ms := range m.Stacks {
+		deps[name] = ms.DependsOn
+	}
+	var err error
+	m.waves, err = order(deps)
+	return err
+}
+
+// manifestTemplate returns the stack's parsed template, rendered and with
+// its includes resolved, and the values its names can be worked out from.
+func (s stack) manifestTemplate(m *manifest, name string) (*sfm.Doc, map[string]string, error) {
+	ms := m.Stacks[name]
+	opts := m.makeOpts(ms, false, "")
+	b, err := s.readTemplate(opts.tmpl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("stack '%s': %w", name, err)
+	}
+	if len(opts.vFiles) > 0 {
+		values, err := loadValues(opts.vFiles)
+		if err != nil {
+			return nil, nil, fmt.Errorf("stack '%s': cant load values: %w", name, err)
+		}
+		if b, err = renderTemplate(opts.tmpl, b, values); err != nil {
+			return nil, nil, fmt.Errorf("stack '%s': %w", name, err)
+		}
+	}
+	if b, err = resolveIncludes(opts.tmpl, b); err != nil {
+		return nil, nil, fmt.Errorf("stack '%s': %w", name, err)
+	}
+	d, err := sfm.ParseTemplate(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("stack '%s': %w", name, err)
+	}
+
+	pf, err := loadParams(opts.pFiles, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("stack '%s': %w", name, err)
+	}
+	for k, v := range ms.params {
+		pf.Params[k] = v
+	}
+	for k, v := range pf.Params {
+		if _, _, ok := stackRef(v); ok {
+			delete(pf.Params, k) // not known until the stack is applied
+		}
+	}
+	return d, d.Vars(name, m.region(ms, s), pf.Params), nil
+}
+
+// stackRef splits a stack:<name>.<output> param value.
+func stackRef(v string) (name, output string, ok bool) {
+	ref, ok := strings.CutPrefix(v, "stack:")
+	if !ok {
+		return "", "", false
+	}
+	name, output, ok = strings.Cut(ref, ".")
+	return name, output, ok && name != "" && output != ""
+}
+
+// stackOutputs returns params with stack:<name>.<output> values replaced by
+// the output of the stack. The stack is looked up in its region if it is in
+// the manifest, as its preview copy if there is a preview, otherwise in this
+// region.
+func (s stack) stackOutputs(m *manifest, params map[string]string) (map[string]string, error) {
+	res := map[string]string{}
+	outputs := map[string]map[string]string{}
+	for k, v := range params {
+		name, output, ok := stackRef(v)
+		if !ok {
+			res[k] = v
+			continue
+		}
+		if _, ok := outputs[name]; !ok {
+			x, sn := s, name
+			if ms, ok := m.Stacks[name]; ok {
+				x, sn = s.inRegion(ms.Region), m.stackName(name)
+			}
+			st, err := sfm.Handle{CFNcli: x.cli}.Get(sn)
+			if err != nil {
+				return nil, fmt.Errorf("param '%s': %w", k, err)
+			}
+			outputs[name] = st.Outputs
+		}
+		val, ok := outputs[name][output]
+		if !ok {
+			return nil, fmt.Errorf("param '%s': stack '%s' has no output '%s'", k, m.stackName(name), output)
+		}
+		res[k] = val
+	}
+	return res, nil
+}
+
+// order sorts the stacks, the keys of deps, into waves. Each wave only
+// depends on the waves before it.
+func order(deps map[string][]string) ([][]string, error) {
+	done := map[string]bool{}
+	waves := [][]string{}
+	for len(done) < len(deps) {
+		wave := []string{}
+		for name, dd := range deps {
+			if done[name] {
+				continue
+			}
+			ready := true
+			for _, dep := range dd {
+				ready = ready && done[dep]
+			}
+			if ready {
+				wave = append(wave, name)
+			}
+		}
+		if len(wave) < 1 {
+			return nil, fmt.Errorf("stacks depend on each other: %s", strings.Join(cycle(deps, done), " -> "))
+		}
+		sort.Strings(wave)
+		for _, name := range wave {
+			done[name] = true
+		}
+		waves = append(waves, wave)
+	}
+	return waves, nil
+}
+
+// cycle returns a dependency cycle between the stacks which aren't done.
+// Every stack left depends on another stack left, so following the
+// dependencies from any of them comes back around.
+func cycle(deps map[string][]string, done map[string]bool) []string {
+	left := []string{}
+	for name := range deps {
+		if !done[name] {
+			left = append(left, name)
+		}
+	}
+	sort.Strings(left)
+
+	path := []string{left[0]}
+	seen := map[string]int{left[0]: 0}
+	for {
+		next := ""
+		for _, dep := range deps[path[len(path)-1]] {
+			if !done[dep] && (next == "" || dep < next) {
+				next = dep
+			}
+		}
+		if i, ok := seen[next]; ok {
+			return append(path[i:], next)
+		}
+		seen[next] = len(path)
+		path = append(path, next)
+	}
+}
+
+// makeOpts returns the mk options for a stack in the manifest.
+func (m *manifest) makeOpts(ms *manifestStack, lint bool, wait string) makeOpts {
+	o := makeOpts{
+		tmpl:        m.path(ms.Template),
+		tagsFile:    m.path(ms.TagsFile),
+		lint:        lint,
+		wait:        wait,
+		caps:        ms.Caps,
+		role:        ms.Role,
+		protect:     ms.Protect,
+		policy:      m.path(ms.Policy),
+		paramValues: ms.params,
+		tagValues:   ms.tags,
+		preview:     m.preview,
+	}
+	for _, f := range ms.ParamsFiles {
+		o.pFiles = append(o.pFiles, m.path(f))
+	}
+	for _, f := range ms.Render {
+		o.vFiles = append(o.vFiles, m.path(f))
+	}
+	return o
+}
+
+// stackName returns the name of the stack, or its preview copy.
+func (m *manifest) stackName(name string) string {
+	if m.preview == "" {
+		return name
+	}
+	return name + "-" + m.preview
+}
+
+// path returns p relative to the manifest; s3 urls and absolute paths are
+// returned as they are.
+func (m *manifest) path(p string) string {
+	if p == "" || filepath.IsAbs(p) || strings.HasPrefix(p, "s3://") {
+		return p
+	}
+	return filepath.Join(m.dir, p)
+}
+
+// region returns the region the stack is applied in.
+func (m *manifest) region(ms *manifestStack, s stack) string {
+	if ms.Region != "" {
+		return ms.Region
+	}
+	return s.cfg.Region
+}
+
+// nodeMap returns the flat map n as strings, lists are joined with commas.
+func nodeMap(n *yaml.Node) (map[string]string, error) {
+	if n.Kind == 0 {
+		return map[string]string{}, nil
+	}
+	if n.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a map", n.Line)
+	}
+	return fromFlatMap(n)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+)
+
+func (s stack) cp(args []string, toRegion, params, stage string, pFiles []string, wait string, nowait bool) int {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "cp requires two positional arguments, the source and destination stacks")
+		fmt.Print(usageCopy)
+		return 64
+	}
+	src, dst := args[0], args[1]
+	dots := wait == "dots"
+	events := wait == "events" || (!nowait && !dots)
+
+	h := sfm.Handle{CFNcli: s.cli}
+	x, err := h.Get(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	body, err := h.GetTemplate(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	overrides, err := loadParams(pFiles, params)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 66
+	}
+
+	// NoEcho parameters are masked by describe stacks, so have to be supplied
+	missing := []string{}
+	for k, v := range x.Params {
+		if _, ok := overrides.Params[k]; !ok && v == "****" {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		fmt.Fprintf(os.Stderr, "cant copy NoEcho params %s; supply them with -p or -pf\n", strings.Join(missing, ", "))
+		return 64
+	}
+	for k, v := range overrides.Params {
+		if _, ok := x.Params[k]; !ok {
+			fmt.Fprintf(os.Stderr, "WARN '%s' is not a parameter of '%s', ignoring\n", k, src)
+			continue
+		}
+		x.Params[k] = v
+	}
+
+	d := s.inRegion(toRegion)
+	dh := sfm.Handle{CFNcli: d.cli}
+	if _, err := dh.Get(dst); err == nil {
+		fmt.Fprintf(os.Stderr, "stack '%s' already exists in %s; not copying over it\n", dst, d.cfg.Region)
+		return 1
+	}
+
+	// everything describe stacks reports carries over: params, tags,
+	// capabilities, topics, termination protection, role, timeout and
+	// rollback settings
+	x.Name, x.Handle = dst, dh
+	if err := x.NewTemplate([]byte(body)); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 65
+	}
+	// the template is staged for the destination, as its bucket has to be
+	// in the same region
+	if x.TemplateURL, err = d.bodyURL(stage, dst, []byte(body)); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 65
+	}
+	if _, err := dh.Make(x); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 3
+	}
+
+	if dots || events {
+		err := d.block(dst, dots, events)
+		fmt.Println()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error on wait: %v\n", err)
+			return 1
+		}
+	}
+	if isPiped() {
+		fmt.Println(dst)
+	}
+	return 0
+}
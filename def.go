@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+	"gopkg.in/yaml.v3"
+)
+
+// noEcho stands in for the values of NoEcho parameters in a stack
+// definition, which cloudformation doesn't give back.
+const noEcho = "sfm:noecho"
+
+// stackDef is a self-contained definition of a stack, written by export-def
+// and read by mk -def. Unlike the Stack from stat it has the template body,
+// the stack policy, and round-trips.
+type stackDef struct {
+	Name       string            `yaml:"name"`
+	Params     map[string]string `yaml:"params,omitempty"`
+	Tags       map[string]string `yaml:"tags,omitempty"`
+	Caps       []string          `yaml:"caps,omitempty"`
+	Topics     []string          `yaml:"sns,omitempty"`
+	Role       string            `yaml:"role,omitempty"`
+	Timeout    int               `yaml:"timeout,omitempty"`
+	NoRollback bool              `yaml:"norb,omitempty"`
+	Protect    bool              `yaml:"protect,omitempty"`
+	Alarms     []string          `yaml:"alarms,omitempty"`
+	Monitor    int               `yaml:"monitor,omitempty"`
+	Policy     string            `yaml:"policy,omitempty"`
+	Template   string            `yaml:"template"`
+}
+
+func (s stack) exportDef(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "export-def accepts one positional argument, the name of the stack")
+		fmt.Print(usageExportDef)
+		return 64
+	}
+	h := sfm.Handle{CFNcli: s.cli}
+	x, err := h.Get(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	body, err := h.GetTemplate(x.Name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	policy, err := h.GetPolicy(x.Name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	def := stackDef{
+		Name:       x.Name,
+		Params:     x.Params,
+		Tags:       x.Tags,
+		Caps:       x.Caps,
+		Topics:     x.Topics,
+		Role:       x.RoleARN,
+		Timeout:    x.Timeout,
+		NoRollback: x.NoRollback,
+		Protect:    x.TermProc,
+		Alarms:     x.RollbackAlarms,
+		Monitor:    x.RollbackMonitor,
+		Policy:     policy,
+		Template:   body,
+	}
+	for k, v := range def.Params {
+		if v == "****" {
+			def.Params[k] = noEcho
+			fmt.Fprintf(os.Stderr, "WARN '%s' is NoEcho; supply it to 'mk -def' with -p or -pf\n", k)
+		}
+	}
+	b, err := yaml.Marshal(def)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cant marshal definition to yaml: %v\n", err)
+		return 1
+	}
+	fmt.Print(string(b))
+	return 0
+}
+
+func loadDef(fn string) (*stackDef, error) {
+	b, err := os.ReadFile(filepath.Clean(fn))
+	if err != nil {
+		return nil, fmt.Errorf("cant read definition: %w", err)
+	}
+	def := &stackDef{}
+	if err := yaml.Unmarshal(b, def); err != nil {
+		return nil, fmt.Errorf("cant unmarshal definition: %w", err)
+	}
+	if def.Template == "" {
+		return nil, fmt.Errorf("definition '%s' has no template", fn)
+	}
+	return def, nil
+}
+
+// makeOpts returns opt with the options from the definition which the mk
+// flags don't set.
+func (def *stackDef) makeOpts(opt makeOpts) makeOpts {
+	if opt.caps == "" {
+		opt.caps = strings.Join(def.Caps, ",")
+	}
+	if opt.sns == "" {
+		opt.sns = strings.Join(def.Topics, ",")
+	}
+	if opt.role == "" {
+		opt.role = def.Role
+	}
+	if opt.timeout == 0 {
+		opt.timeout = def.Timeout
+	}
+	if opt.onFailure == "" {
+		opt.norb = opt.norb || def.NoRollback
+	}
+	if opt.alarms == "" {
+		opt.alarms = strings.Join(def.Alarms, ",")
+	}
+	if opt.monitor == 0 {
+		opt.monitor = def.Monitor
+	}
+	opt.protect = opt.protect || def.Protect
+	return opt
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+	"gopkg.in/yaml.v3"
+)
+
+func (s stack) exports(args []string, encoding string) int {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "exports accepts one positional argument, a glob")
+		fmt.Print(usageExports)
+		return 64
+	}
+	glob := "*"
+	if len(args) > 0 {
+		glob = args[0]
+	}
+
+	h := sfm.Handle{CFNcli: s.cli}
+	ee, err := h.Exports(glob)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if encoding == "text" {
+		for _, e := range ee {
+			fmt.Printf("%s\t%s\t%s\n", e.Name, e.Value, e.Stack)
+		}
+		return 0
+	}
+	return encode(encoding, ee)
+}
+
+func (s stack) imports(args []string, encoding string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "imports accepts one positional argument, the export name")
+		fmt.Print(usageImports)
+		return 64
+	}
+
+	h := sfm.Handle{CFNcli: s.cli}
+	ss, err := h.Importers(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if encoding == "text" {
+		for _, name := range ss {
+			fmt.Println(name)
+		}
+		return 0
+	}
+	return encode(encoding, ss)
+}
+
+// encode prints v as yaml or json.
+func encode(encoding string, v interface{}) int {
+	switch encoding {
+	case "yaml", "yml":
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cant marshal to yaml: %v\n", err)
+			return 1
+		}
+		fmt.Print(string(b))
+	case "json":
+		b, err := json.Marshal(v)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cant marshal to json: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(b))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown encoding '%s'\n", encoding)
+		return 1
+	}
+	return 0
+}
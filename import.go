@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+	"gopkg.in/yaml.v3"
+)
+
+func (s stack) imprt(args []string, tmpl, mapFile, params string, pFiles []string, yes bool, wait string, nowait bool) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "import accepts one positional argument, the name of the stack")
+		fmt.Print(usageImport)
+		return 64
+	}
+	if tmpl == "" || mapFile == "" {
+		fmt.Fprintln(os.Stderr, "import requires a template (-t) and a resource map (-map)")
+		fmt.Print(usageImport)
+		return 64
+	}
+	stack := args[0]
+	dots := wait == "dots"
+	events := wait == "events" || (!nowait && !dots)
+
+	b, err := s.readTemplate(tmpl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if b, err = resolveIncludes(tmpl, b); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 65
+	}
+	pf, err := loadParams(pFiles, params)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 66
+	}
+
+	h := sfm.Handle{CFNcli: s.cli}
+	x := sfm.Stack{Name: stack, Params: pf.Params, Tags: pf.Tags, Handle: h}
+	if err := x.NewTemplate(b); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 65
+	}
+
+	rr, err := s.importResources(string(b), mapFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 66
+	}
+
+	cs, cc, err := h.Import(x, rr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 3
+	}
+	printChanges(cc)
+
+	if !yes && !confirm(fmt.Sprintf("execute the import into '%s'?", stack)) {
+		fmt.Fprintln(os.Stderr, "not importing; use -yes to import without asking")
+		if err := h.DeleteChangeSet(stack, cs); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		return 1
+	}
+	if _, err := h.ExecuteChangeSet(stack, cs); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 3
+	}
+
+	if dots || events {
+		err := s.block(stack, dots, events)
+		fmt.Println()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error on wait: %v\n", err)
+			return 1
+		}
+	}
+
+	if isPiped() {
+		fmt.Println(stack)
+	}
+	return 0
+}
+
+// importResources reads the resource map, whose keys are logical ids in the
+// template and whose values are either the resource's identifier properties
+// or, for types identified by a single property, the identifier's value.
+func (s stack) importResources(body, mapFile string) ([]sfm.ImportResource, error) {
+	b, err := os.ReadFile(filepath.Clean(mapFile))
+	if err != nil {
+		return nil, fmt.Errorf("cant read resource map: %w", err)
+	}
+	m := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("cant unmarshal resource map: %w", err)
+	}
+
+	d, err := sfm.ParseTemplate([]byte(body))
+	if err != nil {
+		return nil, fmt.Errorf("cant parse template: %w", err)
+	}
+	var sum sfm.Summary // only needed for single value identifiers
+	ids := []string{}
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	rr := []sfm.ImportResource{}
+	for _, id := range ids {
+		r := sfm.ImportResource{LogicalID: id, Identifier: map[string]string{}}
+		switch v := m[id].(type) {
+		case map[string]interface{}:
+			for k, iv := range v {
+				r.Identifier[k] = fmt.Sprint(iv)
+			}
+		case string, int:
+			if sum.Identifiers == nil {
+				h := sfm.Handle{CFNcli: s.cli}
+				if sum, err = h.Validate(body, ""); err != nil {
+					return nil, err
+				}
+			}
+			t := d.Section("Resources").Get(id).Get("Type")
+			if t == nil {
+				return nil, fmt.Errorf("resource '%s' is not in the template", id)
+			}
+			props := sum.Identifiers[t.Value]
+			if len(props) != 1 {
+				return nil, fmt.Errorf("'%s' is a %s which is identified by %v, map each of them", id, t.Value, props)
+			}
+			r.Identifier[props[0]] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("'%s' must map to an identifier or a map of identifier properties", id)
+		}
+		rr = append(rr, r)
+	}
+	return rr, nil
+}
+
+// printChanges prints a change set's changes to stderr.
+func printChanges(cc []sfm.Change) {
+	for _, c := range cc {
+		pid := c.PhysicalID
+		if pid == "" {
+			pid = "-"
+		}
+		line := fmt.Sprintf("%-8s %-30s %-30s %s", c.Action, c.LogicalID, c.Type, pid)
+		if c.Replacement != "" && c.Replacement != "False" {
+			line += " (replacement: " + c.Replacement + ")"
+		}
+		fmt.Fprintln(os.Stderr, line)
+	}
+}
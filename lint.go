@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+)
+
+func (s stack) lint(args []string, vFiles []string, specFile, encoding string) int {
+	if encoding != "text" && encoding != "json" && encoding != "sarif" {
+		fmt.Fprintf(os.Stderr, "unknown encoding '%s'\n", encoding)
+		fmt.Print(usageLint)
+		return 64
+	}
+	if len(args) < 1 && !havePipe() {
+		fmt.Fprintln(os.Stderr, "lint requires a template path or a template on stdin")
+		fmt.Print(usageLint)
+		return 64
+	}
+	if len(args) < 1 {
+		args = []string{""}
+	}
+
+	var spec *sfm.Spec
+	if specFile != "" {
+		b, err := os.ReadFile(filepath.Clean(specFile))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cant read spec: %v\n", err)
+			return 66
+		}
+		if spec, err = sfm.LoadSpec(b); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 66
+		}
+	}
+
+	results := map[string][]sfm.Finding{}
+	for _, tmpl := range args {
+		b, err := s.readTemplate(tmpl)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		ff, err := lintTemplate(tmpl, b, vFiles, spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 65
+		}
+		if tmpl == "" {
+			tmpl = "stdin"
+		}
+		results[tmpl] = ff
+	}
+
+	if err := writeFindings(os.Stdout, encoding, results); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	for _, ff := range results {
+		for _, f := range ff {
+			if f.Level == sfm.LevelError {
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// lintTemplate renders the template with the values files, if any, resolves
+// includes and lints the result. Resources are also checked against the
+// resource specification when one is supplied.
+func lintTemplate(tmpl string, b []byte, vFiles []string, spec *sfm.Spec) ([]sfm.Finding, error) {
+	if len(vFiles) > 0 {
+		values, err := loadValues(vFiles)
+		if err != nil {
+			return nil, fmt.Errorf("cant load values: %w", err)
+		}
+		if b, err = renderTemplate(tmpl, b, values); err != nil {
+			return nil, err
+		}
+	}
+	b, err := resolveIncludes(tmpl, b)
+	if err != nil {
+		return nil, err
+	}
+	d, err := sfm.ParseTemplate(b)
+	if err != nil {
+		return nil, fmt.Errorf("cant lint template: %w", err)
+	}
+	ff := sfm.Lint(d)
+	if spec != nil {
+		ff = append(ff, sfm.LintSpec(d, spec)...)
+		sort.SliceStable(ff, func(i, j int) bool {
+			if ff[i].Line != ff[j].Line {
+				return ff[i].Line < ff[j].Line
+			}
+			return ff[i].Column < ff[j].Column
+		})
+	}
+	return ff, nil
+}
+
+func writeFindings(w io.Writer, encoding string, results map[string][]sfm.Finding) error {
+	names := []string{}
+	for n := range results {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	switch encoding {
+	case "json":
+		b, err := json.Marshal(results)
+		if err != nil {
+			return fmt.Errorf("cant marshal findings to json: %w", err)
+		}
+		fmt.Fprintln(w, string(b))
+	case "sarif":
+		b, err := json.MarshalIndent(sarif(names, results), "", "  ")
+		if err != nil {
+			return fmt.Errorf("cant marshal findings to sarif: %w", err)
+		}
+		fmt.Fprintln(w, string(b))
+	default:
+		for _, n := range names {
+			for _, f := range results[n] {
+				fmt.Fprintf(w, "%s:%d:%d\t%s\t%s\t%s\n", n, f.Line, f.Column, f.Level, f.Rule, f.Message)
+			}
+		}
+	}
+	return nil
+}
+
+// sarif returns the findings as a SARIF 2.1.0 log, which code scanning tools
+// such as github can display.
+func sarif(names []string, results map[string][]sfm.Finding) map[string]interface{} {
+	ids := []string{}
+	for id := range sfm.LintRules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	rules := []map[string]interface{}{}
+	for _, id := range ids {
+		rules = append(rules, map[string]interface{}{
+			"id":               id,
+			"shortDescription": map[string]string{"text": sfm.LintRules[id]},
+		})
+	}
+
+	rr := []map[string]interface{}{}
+	for _, n := range names {
+		for _, f := range results[n] {
+			loc := map[string]interface{}{
+				"artifactLocation": map[string]string{"uri": n},
+			}
+			if f.Line > 0 {
+				loc["region"] = map[string]int{"startLine": f.Line, "startColumn": f.Column}
+			}
+			rr = append(rr, map[string]interface{}{
+				"ruleId":    f.Rule,
+				"level":     f.Level,
+				"message":   map[string]string{"text": f.Message + " (" + f.Path + ")"},
+				"locations": []map[string]interface{}{{"physicalLocation": loc}},
+			})
+		}
+	}
+
+	return map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []map[string]interface{}{{
+			"tool": map[string]interface{}{
+				"driver": map[string]interface{}{
+					"name":           "sfm",
+					"version":        version,
+					"informationUri": "https://github.com/toolsdotgo/sfm",
+					"rules":          rules,
+				},
+			},
+			"results": rr,
+		}},
+	}
+}
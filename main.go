@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -11,10 +13,10 @@ import (
 	"net/url"
 	"os"
 	"path"
-	"path/filepath"
 	"runtime"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -24,7 +26,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/toolsdotgo/sfm/pkg/sfm"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 var DEBUG = false // set to true via envar
@@ -43,19 +45,36 @@ func (m *multiFlag) Set(v string) error {
 type stack struct {
 	cfg aws.Config
 	cli *cloudformation.Client
+
+	// where mk and block print, os.Stdout and os.Stderr if nil; apply
+	// prefixes them with the stack name when stacks run in parallel
+	out io.Writer
+	err io.Writer
+}
+
+func (s stack) stdout() io.Writer {
+	if s.out != nil {
+		return s.out
+	}
+	return os.Stdout
+}
+
+func (s stack) stderr() io.Writer {
+	if s.err != nil {
+		return s.err
+	}
+	return os.Stderr
 }
 
-// Template ...
-type Template struct {
-	AWSTemplateFormatVersion string                 `yaml:"AWSTemplateFormatVersion,omitempty"`
-	Transform                string                 `yaml:"Transform,omitempty"`
-	Description              string                 `yaml:"Description,omitempty"`
-	Metadata                 map[string]interface{} `yaml:"Metadata,omitempty"`
-	Parameters               map[string]interface{} `yaml:"Parameters,omitempty"`
-	Mappings                 map[string]interface{} `yaml:"Mappings,omitempty"`
-	Conditions               map[string]interface{} `yaml:"Conditions,omitempty"`
-	Resources                map[string]interface{} `yaml:"Resources,omitempty"`
-	Outputs                  map[string]interface{} `yaml:"Outputs,omitempty"`
+// inRegion returns a copy of s which works in region, or s if region is
+// empty or the same.
+func (s stack) inRegion(region string) stack {
+	if region == "" || region == s.cfg.Region {
+		return s
+	}
+	cfg := s.cfg.Copy()
+	cfg.Region = region
+	return stack{cfg: cfg, cli: cloudformation.NewFromConfig(cfg), out: s.out, err: s.err}
 }
 
 func main() {
@@ -69,10 +88,11 @@ func main() {
 
 	flag.Parse()
 
-	// sfm ls [-h|-v] [glob]
+	// sfm ls [-h|-v|-graph] [glob]
 	fsList := flag.NewFlagSet("ls", flag.ExitOnError)
 	fListHelp := fsList.Bool("h", false, "show help for ls")
 	fListVerbose := fsList.Bool("v", false, "list mode verbose")
+	fListGraph := fsList.Bool("graph", false, "print the dependencies between stacks from their exports and imports")
 
 	// sfm mk [-h] [-p k=v,k=v,k=v...] [-t template] [-norb] <stack>
 	var pff multiFlag
@@ -87,13 +107,33 @@ func main() {
 	fMakeNoWait := fsMake.Bool("nowait", false, "don't block on the operation")
 	fMakeTags := fsMake.String("tags", "", "k=v,k=v... tags for the stack")
 	fMakeTagsFile := fsMake.String("tagsfile", "", "yaml of json file containing tags for the stack")
-
-	// sfm rm [-h] <stack>
+	var rff multiFlag
+	fsMake.Var(&rff, "render", "values file; render the template with text/template before use")
+	fMakeLint := fsMake.Bool("lint", false, "lint the template before creating or updating the stack")
+	fMakeCaps := fsMake.String("caps", "", "capabilities to pass instead of those the template requires, or 'none'")
+	fMakeRole := fsMake.String("role", "", "arn of the service role cloudformation uses for the operation")
+	fMakeTimeout := fsMake.Int("timeout", 0, "minutes before a create times out")
+	fMakeOnFailure := fsMake.String("onfailure", "", "action on create failure: DELETE, DO_NOTHING, ROLLBACK")
+	fMakeProtect := fsMake.Bool("protect", false, "enable termination protection")
+	fMakeAlarms := fsMake.String("alarms", "", "cloudwatch alarm arns which roll back the operation")
+	fMakeMonitor := fsMake.Int("monitor", 0, "minutes to monitor the rollback alarms after the operation")
+	fMakeResTypes := fsMake.String("restypes", "", "resource types the stack is allowed to use")
+	fMakePolicy := fsMake.String("policy", "", "stack policy file as json")
+	fMakeUpdatePolicy := fsMake.String("policy-during-update", "", "stack policy file as json which overrides the stack policy during this update")
+	fMakeRecover := fsMake.Bool("recover", false, "continue the rollback of a stack in UPDATE_ROLLBACK_FAILED before updating it")
+	fMakeRecreate := fsMake.Bool("recreate", false, "delete and recreate a stack which failed to create without asking")
+	fMakeTTL := fsMake.String("ttl", "", "time after creation when 'sfm reap' deletes the stack, eg. 48h or 7d")
+	fMakePreview := fsMake.String("preview", "", "make a preview copy of the stack, suffixing its name and exports")
+	fMakeDef := fsMake.String("def", "", "stack definition from 'sfm export-def' to make the stack from")
+
+	// sfm rm [-h] <stack|glob>...
 	fsRemv := flag.NewFlagSet("rm", flag.ExitOnError)
 	fRemvHelp := fsRemv.Bool("h", false, "show help for rm")
 	fRemvForce := fsRemv.Bool("force", false, "try to automagically remove buckets - DATA LOSS")
 	fRemvWait := fsRemv.String("wait", "", "block on the operation, value is: dots, events (default), ???")
 	fRemvNoWait := fsRemv.Bool("nowait", false, "don't block on the operation")
+	fRemvUnprotect := fsRemv.Bool("unprotect", false, "disable termination protection before deleting")
+	fRemvYes := fsRemv.Bool("yes", false, "delete several stacks without asking")
 
 	// sfm wait [-h] <stack>
 	fsWait := flag.NewFlagSet("wait", flag.ExitOnError)
@@ -101,6 +141,105 @@ func main() {
 	fWaitDots := fsWait.Bool("dots", false, "show progress with dots")
 	fWaitEvents := fsWait.Bool("events", false, "print events as they are polled")
 
+	// sfm render [-h] [-t template] [values...]
+	fsRender := flag.NewFlagSet("render", flag.ExitOnError)
+	fRenderHelp := fsRender.Bool("h", false, "show help for render")
+	fRenderTempl := fsRender.String("t", "", "template file - or pass one in on stdin")
+
+	// sfm lint [-h] [-e encoding] [-render values] [template...]
+	var lrff multiFlag
+	fsLint := flag.NewFlagSet("lint", flag.ExitOnError)
+	fsLint.Var(&lrff, "render", "values file; render the template with text/template before linting")
+	fLintHelp := fsLint.Bool("h", false, "show help for lint")
+	fLintEncoding := fsLint.String("e", "text", "output encoding: text, json, sarif")
+	fLintSpec := fsLint.String("spec", "", "cloudformation resource specification file to validate resources against")
+
+	// sfm validate [-h] [-e encoding] [-render values] [template]
+	var vrff multiFlag
+	fsValidate := flag.NewFlagSet("validate", flag.ExitOnError)
+	fsValidate.Var(&vrff, "render", "values file; render the template with text/template before validating")
+	fValidateHelp := fsValidate.Bool("h", false, "show help for validate")
+	fValidateEncoding := fsValidate.String("e", "text", "output encoding: text, yaml, json")
+
+	// sfm policy [-h] get|set|clear <stack> [file]
+	fsPolicy := flag.NewFlagSet("policy", flag.ExitOnError)
+	fPolicyHelp := fsPolicy.Bool("h", false, "show help for policy")
+
+	// sfm protect [-h] on|off <stack>
+	fsProtect := flag.NewFlagSet("protect", flag.ExitOnError)
+	fProtectHelp := fsProtect.Bool("h", false, "show help for protect")
+
+	// sfm continue-rollback [-h] [-skip res,res] <stack>
+	fsContinue := flag.NewFlagSet("continue-rollback", flag.ExitOnError)
+	fContinueHelp := fsContinue.Bool("h", false, "show help for continue-rollback")
+	fContinueSkip := fsContinue.String("skip", "", "logical ids of resources to skip")
+	fContinueRole := fsContinue.String("role", "", "arn of the service role cloudformation uses for the rollback")
+	fContinueWait := fsContinue.String("wait", "", "block on the operation, value is: dots, events (default), ???")
+	fContinueNoWait := fsContinue.Bool("nowait", false, "don't block on the operation")
+
+	// sfm import [-h] -t template -map resources [-p k=v...] <stack>
+	var ipff multiFlag
+	fsImport := flag.NewFlagSet("import", flag.ExitOnError)
+	fsImport.Var(&ipff, "pf", "params file as yaml or json")
+	fImportHelp := fsImport.Bool("h", false, "show help for import")
+	fImportTempl := fsImport.String("t", "", "template file including the resources to import")
+	fImportMap := fsImport.String("map", "", "yaml or json file mapping logical ids to resource identifiers")
+	fImportParams := fsImport.String("p", "", "k=v,k=v... parameters for the template")
+	fImportYes := fsImport.Bool("yes", false, "execute the import without asking")
+	fImportWait := fsImport.String("wait", "", "block on the operation, value is: dots, events (default), ???")
+	fImportNoWait := fsImport.Bool("nowait", false, "don't block on the operation")
+
+	// sfm mv [-h] [-t template] [-map resources] <src> <dst> <logical id...>
+	fsMove := flag.NewFlagSet("mv", flag.ExitOnError)
+	fMoveHelp := fsMove.Bool("h", false, "show help for mv")
+	fMoveTempl := fsMove.String("t", "", "destination template file including the moved resources")
+	fMoveMap := fsMove.String("map", "", "yaml or json file mapping logical ids to resource identifiers")
+	fMoveYes := fsMove.Bool("yes", false, "move without asking")
+	fMoveWait := fsMove.String("wait", "", "block on the operations, value is: dots, events (default), ???")
+	fMoveNoWait := fsMove.Bool("nowait", false, "don't print progress while blocking on the operations")
+
+	// sfm apply [-h] [-plan] [-lint] [-wait style] <manifest>
+	fsApply := flag.NewFlagSet("apply", flag.ExitOnError)
+	fApplyHelp := fsApply.Bool("h", false, "show help for apply")
+	fApplyPlan := fsApply.Bool("plan", false, "print the order the stacks would be applied in and exit")
+	fApplyLint := fsApply.Bool("lint", false, "lint each template before creating or updating its stack")
+	fApplyWait := fsApply.String("wait", "", "block on each stack with: dots, events (default)")
+	fApplyParallel := fsApply.Int("parallel", 1, "number of stacks to apply at once")
+	fApplyPreview := fsApply.String("preview", "", "apply preview copies of the stacks, suffixing their names and exports")
+
+	// sfm reap [-h] [-dry-run] [-force] [glob]
+	fsReap := flag.NewFlagSet("reap", flag.ExitOnError)
+	fReapHelp := fsReap.Bool("h", false, "show help for reap")
+	fReapDryRun := fsReap.Bool("dry-run", false, "print the stacks which would be deleted and exit")
+	fReapForce := fsReap.Bool("force", false, "empty the stacks' buckets before deleting them - DATA LOSS")
+	fReapWait := fsReap.String("wait", "", "block on the operations, value is: dots, events (default), ???")
+	fReapNoWait := fsReap.Bool("nowait", false, "don't print progress while blocking on the operations")
+
+	// sfm cp [-h] [-to-region region] [-p k=v...] <src> <dst>
+	var cpff multiFlag
+	fsCopy := flag.NewFlagSet("cp", flag.ExitOnError)
+	fsCopy.Var(&cpff, "pf", "params file as yaml or json")
+	fCopyHelp := fsCopy.Bool("h", false, "show help for cp")
+	fCopyRegion := fsCopy.String("to-region", "", "region to copy the stack to")
+	fCopyParams := fsCopy.String("p", "", "k=v,k=v... parameters to override")
+	fCopyWait := fsCopy.String("wait", "", "block on the operation, value is: dots, events (default), ???")
+	fCopyNoWait := fsCopy.Bool("nowait", false, "don't block on the operation")
+	fCopyStage := fsCopy.String("s3", "", "s3://bucket/prefix to stage templates larger than 51,200 bytes in")
+
+	// sfm export-def [-h] <stack>
+	fsExportDef := flag.NewFlagSet("export-def", flag.ExitOnError)
+	fExportDefHelp := fsExportDef.Bool("h", false, "show help for export-def")
+
+	// sfm exports [-h] [-e encoding] [glob]
+	fsExports := flag.NewFlagSet("exports", flag.ExitOnError)
+	fExportsHelp := fsExports.Bool("h", false, "show help for exports")
+	fExportsEncoding := fsExports.String("e", "text", "output encoding: text, yaml, json")
+
+	// sfm imports [-h] [-e encoding] <export>
+	fsImports := flag.NewFlagSet("imports", flag.ExitOnError)
+	fImportsHelp := fsImports.Bool("h", false, "show help for imports")
+	fImportsEncoding := fsImports.String("e", "text", "output encoding: text, yaml, json")
+
 	// sfm stat [-h] <stack>
 	fsStat := flag.NewFlagSet("stat", flag.ExitOnError)
 	fStatHelp := fsStat.Bool("h", false, "show help for stat")
@@ -119,6 +258,10 @@ func main() {
 		os.Exit(64)
 	}
 	region := *freg
+	fanOut := region == "all" || strings.Contains(region, ",")
+	if fanOut {
+		region = "" // each region is set on a copy of the stack, see each
+	}
 
 	switch flag.Arg(0) {
 	case "ls":
@@ -131,12 +274,45 @@ func main() {
 		_ = fsWait.Parse(flag.Args()[1:])
 	case "stat":
 		_ = fsStat.Parse(flag.Args()[1:])
+	case "render":
+		_ = fsRender.Parse(flag.Args()[1:])
+	case "lint":
+		_ = fsLint.Parse(flag.Args()[1:])
+	case "validate":
+		_ = fsValidate.Parse(flag.Args()[1:])
+	case "policy":
+		_ = fsPolicy.Parse(flag.Args()[1:])
+	case "protect":
+		_ = fsProtect.Parse(flag.Args()[1:])
+	case "continue-rollback":
+		_ = fsContinue.Parse(flag.Args()[1:])
+	case "import":
+		_ = fsImport.Parse(flag.Args()[1:])
+	case "mv":
+		_ = fsMove.Parse(flag.Args()[1:])
+	case "apply":
+		_ = fsApply.Parse(flag.Args()[1:])
+	case "exports":
+		_ = fsExports.Parse(flag.Args()[1:])
+	case "reap":
+		_ = fsReap.Parse(flag.Args()[1:])
+	case "cp":
+		_ = fsCopy.Parse(flag.Args()[1:])
+	case "export-def":
+		_ = fsExportDef.Parse(flag.Args()[1:])
+	case "imports":
+		_ = fsImports.Parse(flag.Args()[1:])
 	default:
 		fmt.Fprintf(os.Stderr, "unknown subcommand '%s'\n", flag.Arg(0))
 		fmt.Print(usageTop)
 		os.Exit(64)
 	}
 
+	if fanOut && !fsList.Parsed() && !fsStat.Parsed() && !fsMake.Parsed() && !fsRemv.Parsed() {
+		fmt.Fprintf(os.Stderr, "'%s' runs in one region; only ls, stat, mk and rm take several with -r\n", flag.Arg(0))
+		os.Exit(64)
+	}
+
 	cfg, err := config.LoadDefaultConfig(
 		context.TODO(),
 		config.WithRegion(region),
@@ -150,27 +326,73 @@ func main() {
 		os.Exit(1)
 	}
 	s := stack{cfg: cfg, cli: cloudformation.NewFromConfig(cfg)}
+	regions := []string{}
+	if fanOut {
+		if regions, err = regionList(cfg, *freg); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		if len(regions) < 1 {
+			fmt.Fprintf(os.Stderr, "no regions in -r '%s'\n", *freg)
+			os.Exit(64)
+		}
+	}
 
 	if fsList.Parsed() {
 		if *fListHelp {
 			fmt.Print(usageList)
 			os.Exit(64)
 		}
-		os.Exit(s.list(fsList.Args(), *fListVerbose))
+		os.Exit(s.each(regions, func(s stack) int {
+			return s.list(fsList.Args(), *fListVerbose, *fListGraph)
+		}))
 	}
 	if fsMake.Parsed() {
 		if *fMakeHelp {
 			fmt.Print(usageMake)
 			os.Exit(64)
 		}
-		os.Exit(s.make(fsMake.Args(), *fMakeTempl, *fMakeParams, pff, *fMakeNoRB, *fMakeWait, *fMakeNoWait, *fMakeTags, *fMakeTagsFile, *fMakeSNS))
+		opt := makeOpts{
+			tmpl:      *fMakeTempl,
+			params:    *fMakeParams,
+			pFiles:    pff,
+			vFiles:    rff,
+			lint:      *fMakeLint,
+			norb:      *fMakeNoRB,
+			wait:      *fMakeWait,
+			nowait:    *fMakeNoWait,
+			tags:      *fMakeTags,
+			tagsFile:  *fMakeTagsFile,
+			sns:       *fMakeSNS,
+			caps:      *fMakeCaps,
+			role:      *fMakeRole,
+			timeout:   *fMakeTimeout,
+			onFailure: *fMakeOnFailure,
+			protect:   *fMakeProtect,
+			alarms:    *fMakeAlarms,
+			monitor:   *fMakeMonitor,
+			resTypes:  *fMakeResTypes,
+
+			policy:       *fMakePolicy,
+			updatePolicy: *fMakeUpdatePolicy,
+			recover:      *fMakeRecover,
+			recreate:     *fMakeRecreate,
+			ttl:          *fMakeTTL,
+			preview:      *fMakePreview,
+			def:          *fMakeDef,
+		}
+		os.Exit(s.each(regions, func(s stack) int {
+			return s.make(fsMake.Args(), opt)
+		}))
 	}
 	if fsRemv.Parsed() {
 		if *fRemvHelp {
 			fmt.Print(usageRemv)
 			os.Exit(64)
 		}
-		os.Exit(s.remv(fsRemv.Args(), *fRemvForce, *fRemvWait, *fRemvNoWait))
+		os.Exit(s.each(regions, func(s stack) int {
+			return s.remv(fsRemv.Args(), *fRemvForce, *fRemvUnprotect, *fRemvYes, *fRemvWait, *fRemvNoWait)
+		}))
 	}
 	if fsWait.Parsed() {
 		if *fWaitHelp {
@@ -184,13 +406,113 @@ func main() {
 			fmt.Print(usageStat)
 			os.Exit(64)
 		}
-		os.Exit(s.stat(fsStat.Args(), *fStatOutputs, *fStatParams, *fStatTags, *fStatRes, *fStatEncoding))
+		os.Exit(s.each(regions, func(s stack) int {
+			return s.stat(fsStat.Args(), *fStatOutputs, *fStatParams, *fStatTags, *fStatRes, *fStatEncoding)
+		}))
+	}
+	if fsRender.Parsed() {
+		if *fRenderHelp {
+			fmt.Print(usageRender)
+			os.Exit(64)
+		}
+		os.Exit(s.render(fsRender.Args(), *fRenderTempl))
+	}
+	if fsLint.Parsed() {
+		if *fLintHelp {
+			fmt.Print(usageLint)
+			os.Exit(64)
+		}
+		os.Exit(s.lint(fsLint.Args(), lrff, *fLintSpec, *fLintEncoding))
+	}
+	if fsValidate.Parsed() {
+		if *fValidateHelp {
+			fmt.Print(usageValidate)
+			os.Exit(64)
+		}
+		os.Exit(s.validate(fsValidate.Args(), vrff, *fValidateEncoding))
+	}
+	if fsPolicy.Parsed() {
+		if *fPolicyHelp {
+			fmt.Print(usagePolicy)
+			os.Exit(64)
+		}
+		os.Exit(s.policy(fsPolicy.Args()))
+	}
+	if fsProtect.Parsed() {
+		if *fProtectHelp {
+			fmt.Print(usageProtect)
+			os.Exit(64)
+		}
+		os.Exit(s.protect(fsProtect.Args()))
+	}
+	if fsContinue.Parsed() {
+		if *fContinueHelp {
+			fmt.Print(usageContinueRollback)
+			os.Exit(64)
+		}
+		os.Exit(s.continueRollback(fsContinue.Args(), *fContinueSkip, *fContinueRole, *fContinueWait, *fContinueNoWait))
+	}
+	if fsImport.Parsed() {
+		if *fImportHelp {
+			fmt.Print(usageImport)
+			os.Exit(64)
+		}
+		os.Exit(s.imprt(fsImport.Args(), *fImportTempl, *fImportMap, *fImportParams, ipff, *fImportYes, *fImportWait, *fImportNoWait))
+	}
+	if fsMove.Parsed() {
+		if *fMoveHelp {
+			fmt.Print(usageMove)
+			os.Exit(64)
+		}
+		os.Exit(s.mv(fsMove.Args(), *fMoveTempl, *fMoveMap, *fMoveYes, *fMoveWait, *fMoveNoWait))
+	}
+	if fsApply.Parsed() {
+		if *fApplyHelp {
+			fmt.Print(usageApply)
+			os.Exit(64)
+		}
+		os.Exit(s.apply(fsApply.Args(), *fApplyPlan, *fApplyLint, *fApplyWait, *fApplyParallel, *fApplyPreview))
+	}
+	if fsExports.Parsed() {
+		if *fExportsHelp {
+			fmt.Print(usageExports)
+			os.Exit(64)
+		}
+		os.Exit(s.exports(fsExports.Args(), *fExportsEncoding))
+	}
+	if fsReap.Parsed() {
+		if *fReapHelp {
+			fmt.Print(usageReap)
+			os.Exit(64)
+		}
+		os.Exit(s.reap(fsReap.Args(), *fReapDryRun, *fReapForce, *fReapWait, *fReapNoWait))
+	}
+	if fsCopy.Parsed() {
+		if *fCopyHelp {
+			fmt.Print(usageCopy)
+			os.Exit(64)
+		}
+		os.Exit(s.cp(fsCopy.Args(), *fCopyRegion, *fCopyParams, *fCopyStage, cpff, *fCopyWait, *fCopyNoWait))
+	}
+	if fsExportDef.Parsed() {
+		if *fExportDefHelp {
+			fmt.Print(usageExportDef)
+			os.Exit(64)
+		}
+		os.Exit(s.exportDef(fsExportDef.Args()))
+	}
+	if fsImports.Parsed() {
+		if *fImportsHelp {
+			fmt.Print(usageImports)
+			os.Exit(64)
+		}
+		os.Exit(s.imports(fsImports.Args(), *fImportsEncoding))
 	}
 }
 
-func (s stack) list(args []string, verbose bool) int {
+func (s stack) list(args []string, verbose, graph bool) int {
 	if len(args) > 1 {
-		fmt.Fprintln(os.Stderr, "ls accepts one positional argument, a glob")
+		fmt.Fprintln(s.stderr(), "ls accepts one positional argument, a glob")
 		fmt.Print(usageList)
 		return 64
 	}
@@ -200,86 +522,209 @@ func (s stack) list(args []string, verbose bool) int {
 	}
 
 	h := sfm.Handle{CFNcli: s.cli}
+	if graph {
+		dd, err := h.Dependencies(glob)
+		if err != nil {
+			fmt.Fprintf(s.stderr(), "cant list dependencies: %v\n", err)
+			return 1
+		}
+		for _, d := range dd {
+			fmt.Fprintf(s.stdout(), "%s\t%s\t%s\n", d.Stack, d.Exporter, d.Export)
+		}
+		return 0
+	}
+
 	ss, err := h.List(glob)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "cant list stacks: %v\n", err)
+		fmt.Fprintf(s.stderr(), "cant list stacks: %v\n", err)
 		return 1
 	}
-	for _, s := range ss {
+	for _, x := range ss {
 		if verbose {
-			fmt.Println(s.StringVerbose())
+			fmt.Fprintln(s.stdout(), x.StringVerbose())
 			continue
 		}
-		fmt.Println(s)
+		fmt.Fprintln(s.stdout(), x)
 	}
 
 	return 0
 }
 
-func (s stack) make(args []string, tmpl string, params string, pFiles []string, norb bool, wait string, nowait bool, tags, tagsFile, sns string) int {
+// makeOpts are the options to mk, see usageMake.
+type makeOpts struct {
+	tmpl     string
+	params   string
+	pFiles   []string
+	vFiles   []string
+	lint     bool
+	norb     bool
+	wait     string
+	nowait   bool
+	tags     string
+	tagsFile string
+	sns      string
+
+	caps      string
+	role      string
+	timeout   int
+	onFailure string
+	protect   bool
+	alarms    string
+	monitor   int
+	resTypes  string
+
+	policy       string
+	updatePolicy string
+	recover      bool
+	recreate     bool
+	ttl          string
+	preview      string
+	def          string
+
+	// set by apply from the manifest
+	paramValues map[string]string
+	tagValues   map[string]string
+}
+
+func (s stack) make(args []string, opt makeOpts) int {
+	var def *stackDef
+	if opt.def != "" {
+		var err error
+		if def, err = loadDef(opt.def); err != nil {
+			fmt.Fprintf(s.stderr(), "%v\n", err)
+			return 66
+		}
+		if opt.tmpl != "" {
+			fmt.Fprintln(s.stderr(), "-def and -t are mutually exclusive flags; choose one")
+			fmt.Print(usageMake)
+			return 64
+		}
+		if len(args) == 0 {
+			args = []string{def.Name}
+		}
+		opt = def.makeOpts(opt)
+	}
 	if len(args) != 1 {
-		fmt.Fprintln(os.Stderr, "mk accepts one positional argument, the name of the stack")
+		fmt.Fprintln(s.stderr(), "mk accepts one positional argument, the name of the stack")
 		fmt.Print(usageMake)
 		return 64
 	}
 	stack := args[0]
 	inPipe := havePipe()
+	suffix := ""
+	if opt.preview != "" {
+		if suffix = previewSuffix(opt.preview); suffix == "" {
+			fmt.Fprintf(s.stderr(), "cant use '%s' as a preview suffix, it needs letters or numbers\n", opt.preview)
+			return 64
+		}
+		stack = args[0] + "-" + suffix
+	}
 
-	if tmpl == "" && !inPipe {
-		fmt.Fprintln(os.Stderr, "no template flag supplied and no pipe on stdin")
+	onFailure := types.OnFailure(strings.ToUpper(opt.onFailure))
+	switch onFailure {
+	case "", types.OnFailureDelete, types.OnFailureDoNothing, types.OnFailureRollback:
+	default:
+		fmt.Fprintf(s.stderr(), "unknown -onfailure action '%s'\n", opt.onFailure)
+		fmt.Print(usageMake)
+		return 64
+	}
+	if onFailure != "" && opt.norb {
+		fmt.Fprintln(s.stderr(), "-norb and -onfailure are mutually exclusive flags; choose one")
 		fmt.Print(usageMake)
 		return 64
 	}
 
+	if opt.tmpl == "" && !inPipe && def == nil {
+		fmt.Fprintln(s.stderr(), "no template flag supplied and no pipe on stdin")
+		fmt.Print(usageMake)
+		return 64
+	}
+
+	var b []byte
 	var err error
-	var r io.Reader
-	r = os.Stdin
-	if tmpl != "" {
-		if strings.HasPrefix(tmpl, "s3://") {
-			r, err = openS3(s.cfg, tmpl)
-		} else {
-			r, err = os.Open(path.Clean(tmpl))
-		}
+	if def != nil {
+		b = []byte(def.Template)
+	} else if b, err = s.readTemplate(opt.tmpl); err != nil {
+		fmt.Fprintf(s.stderr(), "%v\n", err)
+		return 1
+	}
+	if (opt.tmpl != "" || def != nil) && inPipe {
+		fmt.Fprintln(s.stderr(), "WARN using template file; ignoring stdin")
+	}
+
+	// render the template and pull in includes before anything else looks at it
+	useURL := strings.HasPrefix(opt.tmpl, "s3://")
+	if len(opt.vFiles) > 0 {
+		values, err := loadValues(opt.vFiles)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "cant open template '%s': %v\n", tmpl, err)
-			return 1
+			fmt.Fprintf(s.stderr(), "cant load values: %v\n", err)
+			return 66
 		}
-		if inPipe {
-			fmt.Fprintln(os.Stderr, "WARN using template file; ignoring stdin")
+		b, err = renderTemplate(opt.tmpl, b, values)
+		if err != nil {
+			fmt.Fprintf(s.stderr(), "%v\n", err)
+			return 65
 		}
+		useURL = false // the rendered body differs from the object in s3
 	}
-
-	b, err := io.ReadAll(r)
+	ib, err := resolveIncludes(opt.tmpl, b)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "cant read template: %v\n", err)
-		return 2
+		fmt.Fprintf(s.stderr(), "%v\n", err)
+		return 65
+	}
+	if !bytes.Equal(ib, b) {
+		b = ib
+		useURL = false
 	}
 
 	// create parameter map and cloudformantion parameter slice
 	cfpp := []types.Parameter{}
-	pmap := map[string]string{}
-
-	// load param files in order
-	for _, f := range pFiles {
-		pp, err := loadYamlFile(f)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "cant load params file '%s': %v\n", f, err)
-			return 66
+	pf, err := loadParams(opt.pFiles, opt.params)
+	if err != nil {
+		fmt.Fprintf(s.stderr(), "%v\n", err)
+		return 66
+	}
+	pmap := pf.Params
+	for k, v := range opt.paramValues {
+		pmap[k] = v
+	}
+	if def != nil {
+		for k, v := range def.Params {
+			if _, ok := pmap[k]; !ok {
+				pmap[k] = v
+			}
 		}
-		for k, v := range pp {
-			pmap[k] = v
+		for k, v := range pmap {
+			if v == noEcho {
+				fmt.Fprintf(s.stderr(), "param '%s' is NoEcho in the definition; supply it with -p or -pf\n", k)
+				return 64
+			}
 		}
 	}
-	for _, kvp := range strings.Split(params, ",") {
-		if kvp == "" {
-			continue
+	if suffix != "" {
+		if b, err = s.previewTemplate(b, args[0], suffix, pmap); err != nil {
+			fmt.Fprintf(s.stderr(), "%v\n", err)
+			return 65
 		}
-		els := strings.SplitN(kvp, "=", 2)
-		if len(els) != 2 {
-			fmt.Fprintf(os.Stderr, "param kvp '%v' missing '=' splitter, ignoring\n", kvp)
-			continue
+		useURL = false
+	}
+	pftags := pf.Tags   // tags from codepipeline template configuration files
+	policy := pf.Policy // stack policy from codepipeline template configuration files
+	if opt.policy != "" {
+		if policy, err = readPolicy(opt.policy); err != nil {
+			fmt.Fprintf(s.stderr(), "%v\n", err)
+			return 66
+		}
+	}
+	if policy == "" && def != nil {
+		policy = def.Policy
+	}
+	updatePolicy := ""
+	if opt.updatePolicy != "" {
+		if updatePolicy, err = readPolicy(opt.updatePolicy); err != nil {
+			fmt.Fprintf(s.stderr(), "%v\n", err)
+			return 66
 		}
-		pmap[els[0]] = els[1]
 	}
 
 	if DEBUG {
@@ -287,50 +732,123 @@ func (s stack) make(args []string, tmpl string, params string, pFiles []string,
 		for k, v := range pmap {
 			msg += fmt.Sprintf("%s=%s\n", k, v)
 		}
-		fmt.Fprintf(os.Stderr, "DEBUG params:\n%s\n", msg)
+		fmt.Fprintf(s.stderr(), "DEBUG params:\n%s\n", msg)
 	}
 
 	// load the template
-	var cftpl Template
-	err = yaml.Unmarshal(b, &cftpl)
+	cftpl, err := sfm.ParseTemplate(b)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "can't unmarshal template: %v\n", err)
+		fmt.Fprintf(s.stderr(), "can't unmarshal template: %v\n", err)
 		return 66
 	}
+	tplParams := cftpl.Section("Parameters")
+
+	if opt.lint {
+		name := opt.tmpl
+		if name == "" {
+			name = "stdin"
+		}
+		ff := sfm.Lint(cftpl)
+		_ = writeFindings(s.stderr(), "text", map[string][]sfm.Finding{name: ff})
+		for _, f := range ff {
+			if f.Level == sfm.LevelError {
+				fmt.Fprintln(s.stderr(), "template has lint errors, not making stack")
+				return 65
+			}
+		}
+	}
+
+	// only pass the capabilities the template needs
+	url := ""
+	if useURL {
+		url = templateURL(opt.tmpl)
+	}
+	h := sfm.Handle{CFNcli: s.cli}
+	caps := []types.Capability{types.CapabilityCapabilityNamedIam, types.CapabilityCapabilityAutoExpand}
+	switch {
+	case opt.caps != "":
+		caps = parseCaps(opt.caps)
+	default:
+		sum, err := h.Validate(string(b), url)
+		if err != nil {
+			fmt.Fprintf(s.stderr(), "WARN cant summarise template, using default capabilities: %v\n", err)
+			break
+		}
+		caps = parseCaps(strings.Join(sum.RequiredCaps(), ","))
+	}
 
 	// only use params that are required by the template
 	for k, v := range pmap {
-		if _, ok := cftpl.Parameters[k]; ok {
+		if tplParams.Get(k) != nil {
 			cfpp = append(cfpp, types.Parameter{ParameterKey: aws.String(k), ParameterValue: aws.String(v)})
 		}
 	}
 
 	// create tag map and cloudformation tag slice
 	tagpp := []types.Tag{}
-	tagmap, err := loadYamlFile(tagsFile)
+	tf, err := loadKVFile(opt.tagsFile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "cant load tags file: %v\n", err)
+		fmt.Fprintf(s.stderr(), "cant load tags file: %v\n", err)
 		return 66
 	}
-	for _, kvp := range strings.Split(tags, ",") {
+	tagmap := pftags
+	if def != nil {
+		for k, v := range def.Tags {
+			if _, ok := tagmap[k]; !ok {
+				tagmap[k] = v
+			}
+		}
+	}
+	// only a flat document's keys are tags; the parameters in an aws cli
+	// list or a codepipeline configuration are not
+	if !tf.Flat && len(tf.Params) > 0 && len(tf.Tags) == 0 {
+		fmt.Fprintf(s.stderr(), "tags file '%s' has parameters but no tags; use it with -pf\n", opt.tagsFile)
+		return 66
+	}
+	if tf.Flat {
+		for k, v := range tf.Params {
+			tagmap[k] = v
+		}
+	}
+	for k, v := range tf.Tags {
+		tagmap[k] = v
+	}
+	for k, v := range opt.tagValues {
+		tagmap[k] = v
+	}
+	for _, kvp := range strings.Split(opt.tags, ",") {
 		if kvp == "" {
 			continue
 		}
 		els := strings.SplitN(kvp, "=", 2)
 		if len(els) != 2 {
-			fmt.Fprintf(os.Stderr, "tag kvp '%v' missing '=' splitter, ignoring\n", kvp)
+			fmt.Fprintf(s.stderr(), "tag kvp '%v' missing '=' splitter, ignoring\n", kvp)
 			continue
 		}
 		tagmap[els[0]] = els[1]
 	}
+	ttl := opt.ttl
+	if suffix != "" {
+		tagmap[previewTag] = suffix
+		if ttl == "" {
+			ttl = previewTTL
+		}
+	}
+	if ttl != "" {
+		if _, err := parseTTL(ttl); err != nil {
+			fmt.Fprintf(s.stderr(), "%v\n", err)
+			return 64
+		}
+		tagmap[ttlTag] = ttl
+	}
 	for k, v := range tagmap {
 		tagpp = append(tagpp, types.Tag{Key: aws.String(k), Value: aws.String(v)})
 	}
 
 	outPipe := isPiped() // if the output is being piped, print the stack name
 
-	dots := wait == "dots"
-	events := wait == "events" || (!nowait && !dots)
+	dots := opt.wait == "dots"
+	events := opt.wait == "events" || (!opt.nowait && !dots)
 
 	// check if stack already exists and do an update if it does
 	// the preference would be to create the stack and then update only
@@ -343,8 +861,19 @@ func (s stack) make(args []string, tmpl string, params string, pFiles []string,
 	dserr := err
 
 	arns := []string{}
-	if sns != "" {
-		arns = strings.Split(sns, ",")
+	if opt.sns != "" {
+		arns = strings.Split(opt.sns, ",")
+	}
+
+	var rbc *types.RollbackConfiguration
+	if opt.alarms != "" || opt.monitor > 0 {
+		rbc = &types.RollbackConfiguration{}
+		for _, arn := range splitList(opt.alarms) {
+			rbc.RollbackTriggers = append(rbc.RollbackTriggers, types.RollbackTrigger{Arn: aws.String(arn), Type: aws.String("AWS::CloudWatch::Alarm")})
+		}
+		if opt.monitor > 0 {
+			rbc.MonitoringTimeInMinutes = aws.Int32(int32(opt.monitor))
+		}
 	}
 
 	var createFailed bool
@@ -353,6 +882,21 @@ func (s stack) make(args []string, tmpl string, params string, pFiles []string,
 			o.Stacks[0].StackStatus == types.StackStatusRollbackFailed || // stack failed to create and failed to rollback creation
 			o.Stacks[0].StackStatus == types.StackStatusRollbackComplete) // stack failed to create but successfully rolled back
 	}
+	if err == nil && o.Stacks[0].StackStatus == types.StackStatusUpdateRollbackFailed {
+		x := sfm.NewFromAWS(o.Stacks[0])
+		x.Handle = h
+		if !opt.recover {
+			fmt.Fprintf(s.stderr(), "stack '%s' is UPDATE_ROLLBACK_FAILED, these resources are blocking the rollback:\n", stack)
+			s.printFailures(x, string(types.StackStatusUpdateRollbackInProgress))
+			fmt.Fprintf(s.stderr(), "fix them, or skip them with 'sfm continue-rollback -skip', or use -recover to continue the rollback and update\n")
+			return 4
+		}
+		fmt.Fprintf(s.stderr(), "stack '%s' is UPDATE_ROLLBACK_FAILED, continuing the rollback\n", stack)
+		if err := s.recoverRollback(stack, nil, opt.role, dots, events); err != nil {
+			fmt.Fprintf(s.stderr(), "%v\n", err)
+			return 4
+		}
+	}
 	if err == nil && !createFailed {
 		// check the existing parameters against the supplied parameters and fill in the blanks
 		for _, p := range o.Stacks[0].Parameters {
@@ -360,20 +904,41 @@ func (s stack) make(args []string, tmpl string, params string, pFiles []string,
 				continue
 			}
 			// only use the params still required by the template
-			if _, ok := cftpl.Parameters[*p.ParameterKey]; ok {
+			if tplParams.Get(*p.ParameterKey) != nil {
 				cfpp = append(cfpp, types.Parameter{ParameterKey: p.ParameterKey, UsePreviousValue: aws.Bool(true)})
 			}
 		}
 
+		if opt.timeout > 0 || onFailure != "" {
+			fmt.Fprintln(s.stderr(), "WARN -timeout and -onfailure only apply when creating a stack; ignoring")
+		}
+		// termination protection isn't part of an update, switch it on first
+		if opt.protect {
+			if err := h.Protect(stack, true); err != nil {
+				fmt.Fprintf(s.stderr(), "%v\n", err)
+				return 3
+			}
+		}
+
 		pp := &cloudformation.UpdateStackInput{
-			StackName:    aws.String(stack),
-			Capabilities: []types.Capability{types.CapabilityCapabilityNamedIam, types.CapabilityCapabilityAutoExpand}, // NOTE
-			Parameters:   cfpp,
-			Tags:         tagpp,
+			StackName:             aws.String(stack),
+			Capabilities:          caps,
+			Parameters:            cfpp,
+			Tags:                  tagpp,
+			ResourceTypes:         splitList(opt.resTypes),
+			RollbackConfiguration: rbc,
 		}
-		if strings.HasPrefix(tmpl, "s3://") {
-			bucket, path, _ := strings.Cut(strings.TrimPrefix(tmpl, "s3://"), "/")
-			pp.TemplateURL = aws.String(fmt.Sprintf("https://%v.s3.amazonaws.com/%v", bucket, path)) // uses the `Legacy global endpoint`
+		if opt.role != "" {
+			pp.RoleARN = aws.String(opt.role)
+		}
+		if policy != "" {
+			pp.StackPolicyBody = aws.String(policy)
+		}
+		if updatePolicy != "" {
+			pp.StackPolicyDuringUpdateBody = aws.String(updatePolicy)
+		}
+		if useURL {
+			pp.TemplateURL = aws.String(templateURL(opt.tmpl))
 		} else {
 			pp.TemplateBody = aws.String(string(b))
 		}
@@ -384,52 +949,73 @@ func (s stack) make(args []string, tmpl string, params string, pFiles []string,
 		if err != nil {
 			// WARN this is heaps dirty and i hate it
 			if strings.HasSuffix(err.Error(), "No updates are to be performed.") {
-				fmt.Fprintln(os.Stderr, "no update required")
+				fmt.Fprintln(s.stderr(), "no update required")
 				if outPipe {
-					fmt.Println(stack)
+					fmt.Fprintln(s.stdout(), stack)
 				}
 				return 0
 			}
-			fmt.Fprintf(os.Stderr, "cant update stack '%s': %v\n", stack, err)
+			fmt.Fprintf(s.stderr(), "cant update stack '%s': %v\n", stack, err)
 			return 3
 		}
 		if dots || events {
 			err := s.block(stack, dots, events)
-			fmt.Println() // HAHA YUCKY
+			fmt.Fprintln(s.stdout()) // HAHA YUCKY
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error on wait: %v\n", err)
+				fmt.Fprintf(s.stderr(), "error on wait: %v\n", err)
 				return 1
 			}
 		}
 		if outPipe {
-			fmt.Println(stack)
+			fmt.Fprintln(s.stdout(), stack)
 		}
 		return 0
 	}
 
 	if createFailed {
-		pp := &cloudformation.DeleteStackInput{StackName: aws.String(stack)}
-		_, err := s.cli.DeleteStack(context.TODO(), pp)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "stack is in CREATE_FAILED state and cant delete: %v\n", err)
+		x := sfm.NewFromAWS(o.Stacks[0])
+		x.Handle = h
+		fmt.Fprintf(s.stderr(), "stack '%s' is %s from a previous create:\n", stack, x.Status)
+		s.printFailures(x, string(types.StackStatusCreateInProgress))
+		if !opt.recreate && !confirm(fmt.Sprintf("delete '%s' and create it again?", stack)) {
+			fmt.Fprintln(s.stderr(), "not recreating stack; use -recreate to delete and create it again")
 			return 4
 		}
-		if err := s.block(stack, false, false); err != nil {
-			fmt.Fprintf(os.Stderr, "stack is in CREATE_FAILED state and cant wait on delete: %v\n", err)
+		if err := s.recreateDelete(x, dots, events); err != nil {
+			fmt.Fprintf(s.stderr(), "stack is %s and cant be deleted: %v\n", x.Status, err)
 			return 4
 		}
 	}
 
+	if updatePolicy != "" {
+		fmt.Fprintln(s.stderr(), "WARN -policy-during-update only applies when updating a stack; ignoring")
+	}
+
 	pp := &cloudformation.CreateStackInput{
-		StackName:       aws.String(stack),
-		Capabilities:    []types.Capability{types.CapabilityCapabilityNamedIam, types.CapabilityCapabilityAutoExpand}, // NOTE
-		DisableRollback: aws.Bool(norb),
-		Parameters:      cfpp,
-		Tags:            tagpp,
-	}
-	if strings.HasPrefix(tmpl, "s3://") {
-		bucket, path, _ := strings.Cut(strings.TrimPrefix(tmpl, "s3://"), "/")
-		pp.TemplateURL = aws.String(fmt.Sprintf("https://%v.s3.amazonaws.com/%v", bucket, path)) // uses the `Legacy global endpoint`
+		StackName:                   aws.String(stack),
+		Capabilities:                caps,
+		Parameters:                  cfpp,
+		Tags:                        tagpp,
+		EnableTerminationProtection: aws.Bool(opt.protect),
+		ResourceTypes:               splitList(opt.resTypes),
+		RollbackConfiguration:       rbc,
+	}
+	if onFailure != "" {
+		pp.OnFailure = onFailure
+	} else {
+		pp.DisableRollback = aws.Bool(opt.norb)
+	}
+	if opt.timeout > 0 {
+		pp.TimeoutInMinutes = aws.Int32(int32(opt.timeout))
+	}
+	if opt.role != "" {
+		pp.RoleARN = aws.String(opt.role)
+	}
+	if policy != "" {
+		pp.StackPolicyBody = aws.String(policy)
+	}
+	if useURL {
+		pp.TemplateURL = aws.String(templateURL(opt.tmpl))
 	} else {
 		pp.TemplateBody = aws.String(string(b))
 	}
@@ -442,58 +1028,84 @@ func (s stack) make(args []string, tmpl string, params string, pFiles []string,
 		if errors.Is(err, &types.NameAlreadyExistsException{}) {
 			fmt.Println("YO") // TODO the bit that doesn't work :(
 		}
-		fmt.Fprintf(os.Stderr, "cant create stack: %v\ndescribestacks err: %v\n", err, dserr)
+		fmt.Fprintf(s.stderr(), "cant create stack: %v\ndescribestacks err: %v\n", err, dserr)
 		return 3
 	}
 
 	if dots || events {
 		err := s.block(stack, dots, events)
-		fmt.Println() // HAHA YUCKY
+		fmt.Fprintln(s.stdout()) // HAHA YUCKY
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error on wait: %v\n", err)
+			fmt.Fprintf(s.stderr(), "error on wait: %v\n", err)
 			return 1
 		}
 	}
 
 	if outPipe {
-		fmt.Println(stack)
+		fmt.Fprintln(s.stdout(), stack)
 	}
 	return 0
 }
 
-func (s stack) remv(args []string, force bool, wait string, nowait bool) int {
-	if len(args) != 1 {
-		fmt.Fprintln(os.Stderr, "rm accepts one positional argument, the name of the stack")
+func (s stack) remv(args []string, force, unprotect, yes bool, wait string, nowait bool) int {
+	if len(args) < 1 {
+		fmt.Fprintln(s.stderr(), "rm requires the name of a stack, several names or a glob")
 		fmt.Print(usageRemv)
 		return 64
 	}
-	if force {
-		// TODO
-		fmt.Fprintln(os.Stderr, "-force is not yet implemented - you're on your own for now!")
-	}
-	stack := args[0]
 	dots := wait == "dots"
 	events := wait == "events" || (!nowait && !dots)
 
 	h := sfm.Handle{CFNcli: s.cli}
-	if _, err := h.Delete(stack); err != nil {
-		fmt.Fprintf(os.Stderr, "cant delete stack: %v\n", err)
+	names, err := expandStacks(h, args)
+	if err != nil {
+		fmt.Fprintf(s.stderr(), "%v\n", err)
+		return 1
+	}
+	if len(names) < 1 {
+		fmt.Fprintf(s.stderr(), "no stacks match '%s'\n", strings.Join(args, " "))
+		return 1
+	}
+	waves, blocked, err := deleteOrder(h, names, s.stderr())
+	if err != nil {
+		fmt.Fprintf(s.stderr(), "%v\n", err)
+		return 1
+	}
+	if len(blocked) > 0 {
+		for _, name := range names {
+			if why, ok := blocked[name]; ok {
+				fmt.Fprintf(s.stderr(), "cant delete '%s': %s\n", name, why)
+			}
+		}
 		return 1
 	}
 
-	if dots || events {
-		err := s.block(stack, dots, events)
-		fmt.Println() // OMG GROSS
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error on wait: %v\n", err)
+	if len(names) > 1 || isGlob(args[0]) {
+		for i, wave := range waves {
+			for _, name := range wave {
+				fmt.Fprintf(s.stderr(), "%d\t%s\n", i+1, name)
+			}
+		}
+		if !yes && !confirm(fmt.Sprintf("delete %d stacks?", len(names))) {
+			fmt.Fprintln(s.stderr(), "not deleting; use -yes to delete without asking")
 			return 1
 		}
 	}
 
-	if isPiped() {
-		fmt.Println(stack)
+	for i, wave := range waves {
+		// a wave can't start until the stacks importing from it are gone
+		block := dots || events || i < len(waves)-1
+		if failed := s.remvWave(wave, unprotect, force, block, dots, events); len(failed) > 0 {
+			left := []string{}
+			for _, w := range waves[i+1:] {
+				left = append(left, w...)
+			}
+			if len(left) > 0 {
+				fmt.Fprintf(s.stderr(), "not deleting the stacks %s import from: %s\n", strings.Join(failed, ", "), strings.Join(left, ", "))
+			}
+			return 1
+		}
 	}
-
 	return 0
 }
 
@@ -505,7 +1117,7 @@ func (s stack) wait(args []string, dots, events bool) int {
 	}
 	stack := ""
 	if havePipe() {
-		b, _ := io.ReadAll(os.Stdin)
+		b, _ := readStdin()
 		stack = strings.TrimSpace(string(b))
 	}
 	if stack == "" {
@@ -603,13 +1215,13 @@ func (s stack) block(name string, dots, events bool) error {
 				tsf := e.Timestamp.In(loc).Format("15:04:05 MST")
 
 				// fmt.Printf("%s\t%s\t%s\t%s\n", e.ResourceStatus, rsr, lri, *e.ResourceType)
-				fmt.Printf("%s %-30s %s%-20s%s %s\n", tsf, lri, rsColor, rs, cReset, rsr)
+				fmt.Fprintf(s.stdout(), "%s %-30s %s%-20s%s %s\n", tsf, lri, rsColor, rs, cReset, rsr)
 				seen = append(seen, *e.Timestamp)
 			}
 		}
 
 		if dots {
-			fmt.Print(".")
+			fmt.Fprint(s.stdout(), ".")
 		}
 		time.Sleep(2 * time.Second)
 		i++
@@ -619,12 +1231,12 @@ func (s stack) block(name string, dots, events bool) error {
 func (s stack) stat(args []string, outputs, params, tags, res bool, encoding string) int {
 	stack := ""
 	if havePipe() {
-		b, _ := io.ReadAll(os.Stdin)
+		b, _ := readStdin()
 		stack = strings.TrimSpace(string(b))
 	}
 	if stack == "" {
 		if len(args) < 1 {
-			fmt.Fprintln(os.Stderr, "stat requires a stack name on stdin or as the only positional argument")
+			fmt.Fprintln(s.stderr(), "stat requires a stack name on stdin or as the only positional argument")
 			fmt.Print(usageStat)
 			return 64
 		}
@@ -634,7 +1246,7 @@ func (s stack) stat(args []string, outputs, params, tags, res bool, encoding str
 	h := sfm.Handle{CFNcli: s.cli}
 	x, err := h.Get(stack)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "cant stat stack: %v\n", err)
+		fmt.Fprintf(s.stderr(), "cant stat stack: %v\n", err)
 		return 1
 	}
 
@@ -649,7 +1261,7 @@ func (s stack) stat(args []string, outputs, params, tags, res bool, encoding str
 	case res:
 		mm, err := x.Resources()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "cant get resources: %v\n", err)
+			fmt.Fprintf(s.stderr(), "cant get resources: %v\n", err)
 			return 1
 		}
 		for id, r := range mm {
@@ -660,10 +1272,10 @@ func (s stack) stat(args []string, outputs, params, tags, res bool, encoding str
 	if outputs || params || tags || res {
 		o, err := outputter(encoding, oo)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
+			fmt.Fprintf(s.stderr(), "%v\n", err)
 			return 1
 		}
-		fmt.Print(o)
+		fmt.Fprint(s.stdout(), o)
 		return 0
 	}
 
@@ -671,18 +1283,18 @@ func (s stack) stat(args []string, outputs, params, tags, res bool, encoding str
 	case "yaml", "yml":
 		b, err := yaml.Marshal(x)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "cant marshal Stack struct to yaml: %v\n", err)
+			fmt.Fprintf(s.stderr(), "cant marshal Stack struct to yaml: %v\n", err)
 			return 1
 		}
-		fmt.Println(string(b))
+		fmt.Fprintln(s.stdout(), string(b))
 		return 0
 	case "json":
 		b, err := json.Marshal(x)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "cant marshal Stack struct to json: %v\n", err)
+			fmt.Fprintf(s.stderr(), "cant marshal Stack struct to json: %v\n", err)
 			return 1
 		}
-		fmt.Println(string(b))
+		fmt.Fprintln(s.stdout(), string(b))
 		return 0
 	case "text":
 		caps := strings.Join(x.Caps, ", ")
@@ -692,16 +1304,50 @@ func (s stack) stat(args []string, outputs, params, tags, res bool, encoding str
 			updated = x.Updated.String()
 		}
 
-		fmts := "Description\t%s\nCreationTime\t%s\nUpdateTime\t%s\nStackStatus\t%s\nStatusReason\t%s\nCapabilities\t%s\nDisableRollback\t%v\nTermProtection\t%v\nNotificationARNs\t%s\n"
-		fmt.Printf(fmts, x.Desc, x.Created, updated, x.Status, x.Reason, caps,
-			x.NoRollback, x.TermProc, topics)
+		fmts := "Description\t%s\nCreationTime\t%s\nUpdateTime\t%s\nStackStatus\t%s\nStatusReason\t%s\nCapabilities\t%s\nDisableRollback\t%v\nTermProtection\t%v\nNotificationARNs\t%s\nRoleARN\t%s\nTimeoutInMinutes\t%d\nRollbackAlarms\t%s\n"
+		fmt.Fprintf(s.stdout(), fmts, x.Desc, x.Created, updated, x.Status, x.Reason, caps,
+			x.NoRollback, x.TermProc, topics, x.RoleARN, x.Timeout, strings.Join(x.RollbackAlarms, ", "))
 
 		return 0
 	}
-	fmt.Fprintf(os.Stderr, "unknown encoding '%s'\n", encoding)
+	fmt.Fprintf(s.stderr(), "unknown encoding '%s'\n", encoding)
 	return 1
 }
 
+var ttyMu sync.Mutex // one question at a time when stacks are applied in parallel
+
+// confirm asks the question on the terminal and returns true if the answer is
+// yes. stdin may be a template, so the terminal is opened directly; without
+// one the answer is no.
+func confirm(q string) bool {
+	ttyMu.Lock()
+	defer ttyMu.Unlock()
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	defer tty.Close()
+	fmt.Fprintf(tty, "%s [y/N] ", q)
+	ans, _ := bufio.NewReader(tty).ReadString('\n')
+	ans = strings.ToLower(strings.TrimSpace(ans))
+	return ans == "y" || ans == "yes"
+}
+
+var (
+	stdinOnce sync.Once
+	stdinBody []byte
+	stdinErr  error
+)
+
+// readStdin returns what's on stdin. It is only read once, so every region
+// mk or stat runs in gets the same template or stack name.
+func readStdin() ([]byte, error) {
+	stdinOnce.Do(func() {
+		stdinBody, stdinErr = io.ReadAll(os.Stdin)
+	})
+	return stdinBody, stdinErr
+}
+
 func havePipe() bool {
 	s, _ := os.Stdin.Stat()
 	return (s.Mode() & os.ModeCharDevice) == 0
@@ -759,61 +1405,105 @@ func status(s types.StackStatus) string {
 	return "err"
 }
 
-func loadYamlFile(fn string) (map[string]string, error) {
-	if fn == "" {
-		// You didn't give me a file path so I won't do anything
-		return map[string]string{}, nil
-	}
-	bb, err := os.ReadFile(filepath.Clean(fn))
-	if err != nil {
-		return nil, fmt.Errorf("can't read file %s: %w", fn, err)
+// readTemplate returns the template body from a local file, an s3:// url or,
+// when tmpl is empty, stdin.
+func (s stack) readTemplate(tmpl string) ([]byte, error) {
+	var err error
+	var r io.Reader
+	if tmpl == "" {
+		b, err := readStdin()
+		if err != nil {
+			return nil, fmt.Errorf("cant read template: %w", err)
+		}
+		r = bytes.NewReader(b)
+	} else {
+		if strings.HasPrefix(tmpl, "s3://") {
+			r, err = openS3(s.cfg, tmpl)
+		} else {
+			r, err = os.Open(path.Clean(tmpl))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cant open template '%s': %w", tmpl, err)
+		}
 	}
 
-	var i interface{}
-	err = yaml.Unmarshal(bb, &i)
+	b, err := io.ReadAll(r)
 	if err != nil {
-		return nil, fmt.Errorf("can't unmarshal file %s: %w", fn, err)
+		return nil, fmt.Errorf("cant read template: %w", err)
 	}
+	return b, nil
+}
 
-	res := map[string]string{}
-	// TODO panics on bad input, add check
-	for k, v := range i.(map[interface{}]interface{}) {
-		key := k.(string)
-		// handle normal 'key: value`
-		if val, ok := v.(string); ok {
-			res[key] = val
+// parseCaps converts a comma separated list of capabilities, with or without
+// the CAPABILITY_ prefix, to cloudformation capabilities. 'none' is an empty
+// list.
+func parseCaps(list string) []types.Capability {
+	var caps []types.Capability
+	for _, c := range splitList(list) {
+		c = strings.ToUpper(c)
+		if c == "NONE" {
 			continue
 		}
-		// handle yaml thinking this `key: value` was a bool (yaml.v2 treats `yes/no`, `true/false`, `on/off` as bool)
-		if val, ok := v.(bool); ok {
-			if val {
-				res[key] = "True"
-				continue
-			}
-			res[key] = "False"
-			continue
+		if !strings.HasPrefix(c, "CAPABILITY_") {
+			c = "CAPABILITY_" + c
 		}
-		// handle lists of values, 'key: \n  - value 1\n  - value 2'
-		if valslice, ok := v.([]interface{}); ok {
-			var vals []string
-			for _, valinterface := range valslice {
-				if val, ok := valinterface.(string); ok {
-					vals = append(vals, val)
-				}
-				if val, ok := v.(bool); ok {
-					if val {
-						vals = append(vals, "True")
-					}
-					vals = append(vals, "False")
-				}
-			}
-			csv := strings.Join(vals, ",")
-			res[key] = csv
-			continue
+		caps = append(caps, types.Capability(c))
+	}
+	return caps
+}
+
+// splitList splits a comma separated list, dropping empty elements.
+func splitList(list string) []string {
+	var ss []string
+	for _, el := range strings.Split(list, ",") {
+		if el = strings.TrimSpace(el); el != "" {
+			ss = append(ss, el)
 		}
-		return nil, fmt.Errorf("can't load in file, something wrong with key %s", key)
 	}
-	return res, nil
+	return ss
+}
+
+// templateURL returns the https url cloudformation reads an s3:// template
+// from.
+func templateURL(tmpl string) string {
+	bucket, path, _ := strings.Cut(strings.TrimPrefix(tmpl, "s3://"), "/")
+	return fmt.Sprintf("https://%v.s3.amazonaws.com/%v", bucket, path) // uses the `Legacy global endpoint`
+}
+
+// maxBody is the largest template body cloudformation accepts; larger
+// templates, up to 1MB, have to be read from s3.
+const maxBody = 51200
+
+// bodyURL returns an empty url when the body of the stack's template is
+// small enough to send to cloudformation. A larger body is uploaded under
+// stage, cp's -s3 prefix, named for the stack and a hash of the body, and
+// the url cloudformation reads it from is returned.
+func (s stack) bodyURL(stage, name string, body []byte) (string, error) {
+	if len(body) <= maxBody {
+		return "", nil
+	}
+	if stage == "" {
+		return "", fmt.Errorf("the template for '%s' is %d bytes, more than the %d cloudformation accepts as a body; stage it in s3 with 'sfm cp -s3 s3://bucket/prefix'", name, len(body), maxBody)
+	}
+	u, err := url.Parse(stage)
+	if err != nil || u.Scheme != "s3" || u.Hostname() == "" {
+		return "", fmt.Errorf("bad -s3 location '%s', expected s3://bucket/prefix", stage)
+	}
+	bucket := u.Hostname()
+	key := path.Join(strings.TrimPrefix(u.Path, "/"), fmt.Sprintf("%s-%x.template", name, sha256.Sum256(body)))
+
+	_, err = s3.NewFromConfig(s.cfg).PutObject(
+		context.Background(),
+		&s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader(body),
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("cant stage template in 's3://%s/%s': %w", bucket, key, err)
+	}
+	return templateURL("s3://" + bucket + "/" + key), nil
 }
 
 func openS3(cfg aws.Config, path string) (*bytes.Buffer, error) {
@@ -899,7 +1589,9 @@ const usageTop = `┌─┐┌┬┐┌─┐┌─┐┬┌─┌─┐┌─
 Usage
   sfm [-h|-v] [-r] <subcommand> [-flags/args...]
 
-  -r  set the aws region manually
+  -r  set the aws region manually; a comma separated list, or 'all' for
+      every region enabled in the account, runs ls, stat, mk or rm in each
+      region at once, with every line of output prefixed with the region
   -h  display this help and exit
   -v  display the program version and exit
 
@@ -911,22 +1603,44 @@ Summary
   coarse-grained, domain-specific subcommands reduce cognitive complexity.
 
 Sub-Commands
-  ls    list stacks
-  mk    create or update a stack
-  rm    delete a stack
-  wait  block on a stack while it's "in progress"
-  stat  print information about a stack
+  ls      list stacks
+  mk      create or update a stack
+  rm      delete a stack
+  wait    block on a stack while it's "in progress"
+  stat    print information about a stack
+  render  render a template with values and print it
+  lint    check a template for structural problems
+  validate
+          check a template with cloudformation and summarise it
+  policy  get, set or clear a stack's policy
+  protect turn termination protection on or off
+  continue-rollback
+          recover a stack from UPDATE_ROLLBACK_FAILED
+  import  bring existing resources into a stack
+  mv      move resources from one stack to another
+  apply   create or update the stacks in a manifest
+  exports list exported values and the stacks which export them
+  imports list the stacks which import an export
+  reap    delete stacks which have expired
+  cp      copy a stack to a new stack
+  export-def
+          print a stack's definition for 'mk -def'
 
   use <subcommand> -h for subcommand-specific help
 
 Using sfm in Pipes
   some sfm subcommands support pipes:
 
-  mk    accepts template content on stdin
-        prints the stack name to stdout on create or update
-  rm    prints the stack name to stdout on delete
-  wait  reads the stack name from stdin
-  stat  reads the stack name from stdin
+  mk      accepts template content on stdin
+          prints the stack name to stdout on create or update
+  rm      prints the stack name to stdout on delete
+  wait    reads the stack name from stdin
+  stat    reads the stack name from stdin
+  render  accepts template content on stdin
+          prints the rendered template to stdout
+  lint    accepts template content on stdin
+  validate
+          accepts template content on stdin
 
 Examples
   aws s3 cp s3://bucket/tmpl.yml - | sfm mk foobar | sfm wait -dots
@@ -938,7 +1652,7 @@ Examples
   sfm rm -wait events foobar
 `
 
-const usageList = `usage: sfm ls [-h|-v] [<glob>]
+const usageList = `usage: sfm ls [-h|-v|-graph] [<glob>]
 
 Summary
   prints all of the stack names in the account.
@@ -946,11 +1660,15 @@ Summary
 Flags
   -h      display this help
   -v      print the create or update (latest) time, the name, and the status
+  -graph  print the live dependencies between stacks instead, one per line,
+          tab-sep: <importing stack> <exporting stack> <export name>.
+          the glob matches the exporting stack.
   <glob>  filter results by glob (see Go filepath.Match for supported globs)
 `
 
-const usageMake = `usage: sfm mk [-h] [-t <file>] [-p k=v,k=v...] [-wait style] [-nowait] <name>
+const usageMake = `usage: sfm mk [-h] [-t <file>] [-p k=v,k=v...] [-render <file>] [-lint] [-wait style] [-nowait] [stack options...] <name>
    or: sfm mk [-p k=v,k=v...] <name> <file (template on stdin)
+   or: sfm mk -def <file> [-p k=v,k=v...] [<name>]
 
 Summary
   mk is the heavy-duty operator in sfm - it creates or updates cloudformation
@@ -958,49 +1676,161 @@ Summary
   sfm exits non-zero if the stack fails to create or update. with -nowait,
   a non-zero exit code is only returned if the cloudformation createstack api
   responds with an error.
+  the stack is given only the capabilities its template requires, as
+  reported by the template summary (see 'sfm validate -h'), unless -caps
+  is supplied.
 
 Parameters
   parameters can be specified in two ways:
     - the -p flag takes a string of parameters in the form
       'key=value,key=value..."
       note: don't use this if your keys or values contain '=' or ','
-    - the -pf flag takes a path to a json or yaml document describing the
-      parameters. the document should be of the form
-      '{"key":"value","key":"value",...}'
+    - the -pf flag takes a path to a document describing the parameters.
+      the shape of the document is detected automatically:
+        flat json/yaml  '{"key":"value","key":"value",...}'
+        aws cli         '[{"ParameterKey":"key","ParameterValue":"value"},...]'
+        codepipeline    '{"Parameters":{...},"Tags":{...},"StackPolicy":{...}}'
+        dotenv          'key=value' lines, for files named *.env or .env*
+      scalar values are used exactly as written (e.g., 'yes', '1.50' and
+      '2024-01-01' are not reformatted) and lists are joined with commas
+      to suit CommaDelimitedList parameters
+      tags in a codepipeline document are applied to the stack, the
+      tagsfile and -tags flag override them; its StackPolicy is set on the
+      stack unless -policy is supplied
       note: -pf can be supplied multiple times - in this case, the files
       are processed in-order and later keys overwrite earlier ones
 
+Failed Creates
+  a stack which failed to create (CREATE_FAILED, ROLLBACK_COMPLETE or
+  ROLLBACK_FAILED) can't be updated, it has to be deleted and created
+  again. mk prints why the previous create failed and asks before deleting
+  the stack; without a terminal to ask on, -recreate is required. the
+  delete is waited on with the -wait style. resources which can't be
+  deleted, e.g., a bucket with objects in it after ROLLBACK_FAILED, are
+  retained and listed so they can be cleaned up by hand.
+
+Previews
+  -preview <suffix> makes a preview copy of the stack, eg. for a pull
+  request, which can live alongside the original:
+    - the stack is named <name>-<suffix>. characters which can't be in a
+      stack name become '-', so a git branch can be used as the suffix.
+    - every export name gets '-<suffix>' appended.
+    - imports of names which have been exported with the suffix, ie. by
+      other preview stacks with the same suffix, import those instead.
+    - the stack is tagged sfm:preview=<suffix> and, unless -ttl is
+      supplied, sfm:ttl=7d so 'sfm reap' cleans it up.
+
+Includes
+  templates can pull in local fragments with the 'Fn::sfm::Include' key,
+  whose value is a path or a list of paths relative to the template:
+
+    Resources:
+      Fn::sfm::Include: ./fragments/alarms.yml
+      Bucket:
+        Type: AWS::S3::Bucket
+
+  inside a section the fragment is a map of entries for that section. at
+  the top level of a template the fragment is a template-like document
+  whose sections (Resources, Outputs, ...) are merged into the template.
+  fragments can include other fragments. defining the same key twice is
+  an error. includes are resolved after rendering and before the template
+  is sent to cloudformation.
+
 Flags
   -h               display this help
   -t <file>        provide a path to the template file
                    the template can also be passed in via stdin
   -p <string>      a list of key/value pairs separated by commas and equals
                    e.g., -p k1=v1,k2=v2,k3=v3
-  -pf <file>       a path to a yaml file containing parameters
+  -pf <file>       a path to a file containing parameters
                    parameters provided by '-p' override the parameter file
                    can be specified multiple times; processed in order, keys overwrite
   -tags <string>   a list of key/value pairs separated by command and equals
                    e.g., -tags tag1=val1,tag2=val2
-  -tagsfile <file> a path to a yaml file containing tags
+  -tagsfile <file> a path to a file containing tags, in any of the shapes
+                   accepted by -pf (aws cli tags use '[{"Key":..,"Value":..}]')
+                   only the Tags of a codepipeline document are used, and
+                   aws cli parameters are an error
                    tags provided by '-tags' override the tagsfile
+  -render <file>   a path to a yaml or json values file; the template is
+                   rendered with go text/template before it is used
+                   can be specified multiple times; later files are merged
+                   over earlier ones (see 'sfm render -h')
+  -lint            lint the template first (see 'sfm lint -h'), findings are
+                   printed to stderr and errors stop the stack being made
   -wait <style>    block on the operation with either 'dots' or 'events'
                    default behaviour is 'events'
   -nowait          dont block on the operation
   <name>           the name of the stack
+
+Stack Options
+  -caps <list>     comma separated capabilities to pass instead of those the
+                   template requires, e.g., -caps IAM,AUTO_EXPAND
+                   the CAPABILITY_ prefix is optional, 'none' passes none
+  -role <arn>      the service role cloudformation uses to make the stack
+  -timeout <mins>  minutes before a create fails; create only
+  -onfailure <act> what to do when a create fails: DELETE, DO_NOTHING or
+                   ROLLBACK (the default); create only, excludes -norb
+  -norb            do not rollback on error, same as -onfailure DO_NOTHING
+  -protect         enable termination protection; on update it is enabled
+                   before the update, it is never disabled by mk
+  -alarms <list>   comma separated cloudwatch alarm arns; the operation is
+                   rolled back if any go into alarm
+  -monitor <mins>  minutes to keep monitoring the alarms after the operation
+  -restypes <list> comma separated resource types the stack may use, e.g.,
+                   AWS::S3::*,AWS::SNS::Topic
+  -sns <list>      comma separated sns topic arns to notify of stack events
+  -ttl <duration>  how long after it is created the stack expires, e.g.,
+                   48h or 7d; sets the sfm:ttl tag (see 'sfm reap -h')
+  -preview <suffix>
+                   make a preview copy of the stack (see Previews)
+  -def <file>      make the stack from a definition written by 'sfm
+                   export-def' instead of -t; the stack name defaults to the
+                   definition's. flags, -p and -pf override the definition's
+                   options, params and tags
+  -policy <file>   a json stack policy to set on the stack, e.g., to deny
+                   Update:Replace on a database (see 'sfm policy -h')
+                   a StackPolicy in a codepipeline -pf file is used if
+                   -policy isn't supplied
+  -policy-during-update <file>
+                   a json stack policy which overrides the stack policy for
+                   this update only, e.g., for a planned migration
+  -recreate        delete and recreate a stack which failed to create without
+                   asking (see Failed Creates)
+  -recover         if the stack is UPDATE_ROLLBACK_FAILED, continue the
+                   rollback and wait for it before updating; without it mk
+                   prints the resources blocking the rollback and exits
+                   (see 'sfm continue-rollback -h')
 `
 
-const usageRemv = `usage: sfm rm [-h] [-force] [-wait style] <name>
+const usageRemv = `usage: sfm rm [-h] [-force] [-unprotect] [-yes] [-wait style] <name|glob>...
 
 Summary
-  this subcommand removes (deletes) a stack.
+  this subcommand removes (deletes) a stack, or several stacks.
+  stacks with termination protection enabled are not deleted unless
+  -unprotect is supplied (see 'sfm protect -h').
+  stacks with exports which other stacks import are not deleted; the
+  importing stacks are listed (see 'sfm imports -h').
+
+Several Stacks
+  given several names or a glob (like 'sfm ls'), rm deletes the stacks in
+  waves: a stack is deleted after the stacks which import its exports. the
+  stacks in a wave are deleted at once, their output prefixed with the
+  stack name. the stacks are listed, tab-sep: <wave> <name>, and rm asks
+  before deleting them unless -yes is supplied. if a stack fails to
+  delete, the waves after it are not started.
 
 Flags
   -h             display this help
-  -force         NOT IMPLEMENTED
+  -force         empty the stack's buckets first so they can be deleted
+                 DATA LOSS - every object and object version is deleted
+  -unprotect     disable termination protection, if enabled, then delete
+  -yes           delete several stacks without asking
   -wait <style>  block on the operation with either 'dots' or 'events'
                  default behaviour is 'events'
   -nowait          dont block on the operation
-  <name>         the name of the stack to delete
+  <name|glob>    the names of the stacks to delete, or globs matching
+                 them (see Go filepath.Match for supported globs)
 `
 
 const usageWait = `usage: sfm wait [-h] [-dots|-events] <name>
@@ -1014,6 +1844,405 @@ Flags
           e.g., sfm mk ... | sfm wait -dots
 `
 
+const usageRender = `usage: sfm render [-h] [-t <file>] [<values>...]
+   or: sfm render [<values>...] <file (template on stdin)
+
+Summary
+  render runs a template through go text/template, resolves any includes
+  (see 'sfm mk -h') and prints the result. mk does the same thing before
+  creating or updating a stack; templates are only rendered when mk is given
+  one or more '-render' values files.
+  the merged values are dot in the template, e.g. given a values file
+
+    subnets: [a, b, c]
+
+  '{{ range $i, $s := .subnets }}Subnet{{ $i }}: ...{{ end }}' creates a
+  resource per subnet.
+  referencing a missing key is an error; use 'hasKey' or 'index' for
+  optional values. dynamic references such as '{{resolve:ssm:name}}' are
+  left as they are for cloudformation.
+
+Functions
+  a subset of sprig (https://masterminds.github.io/sprig/) is available:
+    default empty coalesce ternary required fail
+    quote squote upper lower title trim trimPrefix trimSuffix replace
+    contains hasPrefix hasSuffix splitList join indent nindent
+    b64enc b64dec env
+    list dict keys hasKey until add sub mul div mod toJson toYaml
+
+Flags
+  -h         display this help
+  -t <file>  provide a path to the template file
+             the template can also be passed in via stdin
+  <values>   paths to yaml or json values files
+             later files are merged over earlier ones
+`
+
+const usageLint = `usage: sfm lint [-h] [-e encoding] [-render <file>] [-spec <file>] [<template>...]
+   or: sfm lint [-e encoding] <file (template on stdin)
+
+Summary
+  lint runs offline structural checks against templates:
+    - Ref, Fn::GetAtt, Fn::Sub and Fn::FindInMap targets which don't exist
+    - conditions which are referenced but not defined
+    - DependsOn targets which don't exist
+    - parameters, mappings and conditions which are never used
+    - outputs which export the same name
+    - circular dependencies between resources
+    - more than 500 resources, 200 parameters or 200 outputs
+  with -spec, resources are also validated against a locally cached copy of
+  the cloudformation resource specification:
+    - resource types must exist (Custom:: types are skipped)
+    - property names must exist, with a suggestion for likely typos
+    - required properties must be set
+    - literal values must match the property's type; values which are
+      intrinsic functions are not checked
+  the specification is published per region, e.g.
+    curl -o spec.json.gz https://d1uauaxba7bl26.cloudfront.net/latest/gzip/CloudFormationResourceSpecification.json
+  and may be used gzipped or not.
+  includes are resolved before linting. undefined references are warnings
+  rather than errors when the template declares a Transform.
+  lint exits non-zero if any errors are found; warnings alone exit zero.
+
+Flags
+  -h               display this help
+  -e <encoding>    encode the output (default 'text')
+                   supports 'text', 'json' and 'sarif'
+                   'text' is tab-sep: <file:line:col> <level> <rule> <message>
+  -render <file>   a path to a values file to render the template with first
+                   can be specified multiple times (see 'sfm render -h')
+  -spec <file>     a path to a resource specification file
+  <template>       paths to templates (local or s3://)
+`
+
+const usageValidate = `usage: sfm validate [-h] [-e encoding] [-render <file>] [<template>]
+   or: sfm validate [-e encoding] <file (template on stdin)
+
+Summary
+  validate sends the template to cloudformation's ValidateTemplate and
+  GetTemplateSummary apis and prints the summary: the capabilities the
+  template requires, the transforms it declares, its parameters with their
+  types and defaults, and the resource types it uses. NoEcho defaults are
+  masked in 'text' output.
+  templates from s3:// are validated by url, which cloudformation requires
+  for templates larger than 51,200 bytes; rendered templates and templates
+  with includes are sent as a body, so have to be smaller.
+  mk uses the same summary to pass only the capabilities a template needs.
+  templates with nested stacks get CAPABILITY_NAMED_IAM and
+  CAPABILITY_AUTO_EXPAND as the summary can't see into them.
+
+Flags
+  -h               display this help
+  -e <encoding>    encode the output (default 'text')
+                   supports 'yaml','json','text'; 'text' is tab-sep,
+                   one 'Parameter <name> <type> <default>' line per parameter
+  -render <file>   a path to a values file to render the template with first
+                   can be specified multiple times (see 'sfm render -h')
+  <template>       a path to the template (local or s3://)
+`
+
+const usagePolicy = `usage: sfm policy [-h] get <name>
+   or: sfm policy set <name> [<file>]
+   or: sfm policy clear <name>
+
+Summary
+  policy manages the stack policy, which protects a stack's resources from
+  being updated, e.g., a policy denying 'Update:Replace' on a database
+  stops an update from replacing it.
+
+    get    prints the stack policy as json
+    set    sets the stack policy from a json file, or from stdin
+    clear  sets a policy allowing all updates; cloudformation can't remove
+           a stack policy once one has been set
+
+  to override the policy for a single update, e.g., for a planned
+  migration, use 'sfm mk -policy-during-update <file>'.
+
+Flags
+  -h       display this help
+  <name>   the name of the stack
+  <file>   a path to a json stack policy
+`
+
+const usageProtect = `usage: sfm protect [-h] on|off <name>
+
+Summary
+  protect enables or disables termination protection on a stack. a stack
+  with termination protection can't be deleted; 'sfm rm' refuses to
+  delete it unless given -unprotect.
+
+Flags
+  -h       display this help
+  <name>   the name of the stack
+`
+
+const usageContinueRollback = `usage: sfm continue-rollback [-h] [-skip res,res...] [-role arn] [-wait style] [-nowait] <name>
+
+Summary
+  continue-rollback recovers a stack which is UPDATE_ROLLBACK_FAILED, which
+  happens when a resource can't be returned to its previous state, e.g.,
+  it was changed or deleted outside of cloudformation. once the rollback
+  completes the stack is UPDATE_ROLLBACK_COMPLETE and can be updated.
+  resources which still can't be rolled back can be skipped; they are left
+  as they are and marked UPDATE_COMPLETE, so make sure the template matches
+  them before the next update.
+
+Flags
+  -h             display this help
+  -skip <list>   comma separated logical ids of resources to skip, resources
+                 in nested stacks are named <nested stack>.<logical id>
+  -role <arn>    the service role cloudformation uses for the rollback
+  -wait <style>  block on the operation with either 'dots' or 'events'
+                 default behaviour is 'events'
+  -nowait        dont block on the operation
+  <name>         the name of the stack
+`
+
+const usageImport = `usage: sfm import [-h] -t <file> -map <file> [-p k=v,k=v...] [-pf <file>] [-yes] [-wait style] [-nowait] <name>
+
+Summary
+  import brings existing resources, e.g., buckets and tables made by hand,
+  into a stack without recreating them. the stack is created if it doesn't
+  exist. the template is the stack's whole template: the stack's current
+  resources plus the resources to import, each of which must declare a
+  DeletionPolicy. import creates an IMPORT change set, prints its changes,
+  and asks before executing it; without a terminal to ask on, -yes is
+  required. an import can't change any other resource in the stack.
+
+Resource Map
+  the map is a yaml or json document of logical ids in the template to the
+  properties which identify the existing resource:
+
+    Bucket:
+      BucketName: my-hand-made-bucket
+    Table: my-table                      # single property identifiers
+
+  'sfm validate -e yaml' lists the identifier properties of each type in a
+  template.
+
+Flags
+  -h               display this help
+  -t <file>        a path to the template (local or s3://)
+  -map <file>      a path to the resource map
+  -p <string>      a list of key/value pairs separated by commas and equals
+                   parameters the stack already has keep their values
+  -pf <file>       a path to a file containing parameters (see 'sfm mk -h')
+  -yes             execute the change set without asking
+  -wait <style>    block on the operation with either 'dots' or 'events'
+                   default behaviour is 'events'
+  -nowait          dont block on the operation
+  <name>           the name of the stack
+`
+
+const usageMove = `usage: sfm mv [-h] [-t <file>] [-map <file>] [-yes] [-wait style] [-nowait] <src> <dst> <logical id>...
+
+Summary
+  mv moves resources from one stack to another without recreating them:
+    1. the resources are set to DeletionPolicy Retain in the source stack
+    2. the resources are removed from the source stack, which leaves them
+       in place
+    3. the resources are imported into the destination stack, which is
+       created if it doesn't exist (see 'sfm import -h')
+  everything is worked out and checked before the first step: nothing left
+  in either stack may refer to something which isn't there, e.g., an output
+  of the source stack which refers to a moved resource. the plan is printed
+  and mv asks before starting; without a terminal to ask on, -yes is
+  required.
+  by default the resources are added to the destination stack's current
+  template as they are. if they refer to parameters, conditions or other
+  resources of the source stack, supply the destination template with -t.
+  resources are identified by their physical ids; types identified by more
+  than one property need a -map (see 'sfm import -h').
+
+Checkpoints
+  progress is saved in '.sfm-mv-<src>-<dst>.json' in the current directory
+  after each step. if a step fails, fix the problem and run the same mv
+  again to resume from the failed step. the checkpoint is removed once the
+  move is done.
+
+Flags
+  -h               display this help
+  -t <file>        a path to the destination stack's template, which must
+                   include the moved resources with a DeletionPolicy
+  -map <file>      a path to a resource map for resources which can't be
+                   identified by their physical id
+  -yes             move without asking
+  -wait <style>    print progress with either 'dots' or 'events'
+                   default behaviour is 'events'
+  -nowait          dont print progress; mv always blocks on each step
+  <src>            the name of the stack to move the resources from
+  <dst>            the name of the stack to move the resources to
+  <logical id>     the logical ids of the resources to move
+`
+
+const usageApply = `usage: sfm apply [-h] [-plan] [-lint] [-parallel n] [-preview suffix] [-wait style] <manifest>
+
+Summary
+  apply creates or updates every stack in a manifest, in dependency order,
+  the same way mk does. the plan - the order the stacks are applied in -
+  is printed first, tab-sep: <wave> <name> <region> <template> <dependsOn>.
+  stacks in the same wave don't depend on each other.
+  a stack is applied as soon as the stacks it depends on are done; with
+  -parallel, up to n stacks are applied at once and their output is
+  prefixed with the stack name. stacks which depend on a stack which fails
+  are skipped, other stacks carry on.
+  once every stack is done, the outcome of each is printed, tab-sep:
+  <name> <ok|failed (exit n)|skipped> <duration>. apply exits non-zero if
+  any stack failed or was skipped.
+
+Manifest
+  the manifest is yaml; paths are relative to it:
+
+    region: ap-southeast-2           # default region, otherwise -r or env
+    tags:                            # tags for every stack
+      team: platform
+    stacks:
+      network:
+        template: network.yml        # local or s3://
+        params:
+          Cidr: 10.0.0.0/16
+          Subnets: [a, b, c]         # joined with commas
+      app:
+        template: app.yml
+        paramsFiles: [app.params.yml]
+        render: [app.values.yml]
+        tags: {service: app}
+        region: us-east-1
+        dependsOn: [network]
+
+  each stack takes the keys template, params, paramsFiles, tags, tagsFile,
+  render, region, dependsOn, caps, role, protect and policy, which work
+  like the mk flags of the same names (see 'sfm mk -h'). params override
+  paramsFiles, stack tags override manifest tags.
+
+Dependencies
+  dependsOn doesn't have to list everything; apply reads each template and
+  works out the rest:
+    - a stack which imports a name with Fn::ImportValue depends on the
+      stack in the same region which exports it (Outputs.*.Export.Name).
+      names made with Ref, Fn::Sub and Fn::Join are worked out from the
+      params, parameter defaults, AWS::StackName and AWS::Region.
+    - a param given as stack:<name>.<output> depends on the stack <name>,
+      and is set to its output when the stack is applied. the stack
+      doesn't have to be in the manifest.
+  stacks which depend on each other are an error, the cycle is printed.
+  'sfm ls -graph' shows the dependencies between deployed stacks.
+
+Flags
+  -h             display this help
+  -plan          print the plan and exit
+  -lint          lint each template first (see 'sfm lint -h')
+  -parallel <n>  apply up to n independent stacks at once (default 1)
+  -preview <suffix>
+                 apply preview copies of the stacks (see 'sfm mk -h');
+                 stack:<name>.<output> params use the copy of <name>
+  -wait <style>  block on each stack with either 'dots' or 'events'
+                 default behaviour is 'events'
+  <manifest>     a path to the manifest
+`
+
+const usageReap = `usage: sfm reap [-h] [-dry-run] [-force] [-wait style] [<glob>]
+
+Summary
+  reap deletes the stacks which have expired. a stack expires at the time
+  in its sfm:expires tag (eg. 2026-11-01T00:00Z) or, without one, when the
+  duration in its sfm:ttl tag (eg. 72h or 7d) has passed since it was
+  created. 'sfm mk -ttl' sets the sfm:ttl tag. stacks without either tag
+  are never reaped.
+  expired stacks are deleted like 'sfm rm' deletes several stacks, in
+  waves, without asking. stacks with termination protection, stacks with
+  an operation in progress and stacks which other stacks import from are
+  left alone.
+  every expired stack is printed, tab-sep: <name> <expiry> <outcome>,
+  where the outcome is one of deleted, would delete, failed, skipped,
+  blocked: <reason>, protected or busy, followed by a count of each on
+  stderr. reap exits non-zero if any stack failed to delete.
+
+Flags
+  -h             display this help
+  -dry-run       print the expired stacks and what would happen to them
+  -force         empty the stacks' buckets first so they can be deleted
+                 DATA LOSS - every object and object version is deleted
+  -wait <style>  block on each delete with either 'dots' or 'events'
+                 default behaviour is 'events'
+  -nowait        block on each delete without printing progress
+  <glob>         only reap stacks matching the glob (see Go filepath.Match)
+`
+
+const usageCopy = `usage: sfm cp [-h] [-to-region region] [-p k=v,k=v...] [-pf file] [-s3 s3://bucket/prefix] [-wait style] <src> <dst>
+
+Summary
+  cp creates the stack dst from the stack src: its current template,
+  parameters, tags, capabilities, notification arns, termination
+  protection, role, timeout and rollback settings. eg. to reproduce a
+  production issue in a sandbox with the same configuration.
+  NoEcho parameters can't be read back, so must be supplied with -p or
+  -pf. dst must not exist. the template's export names are the same as
+  src's, so copying a stack with exports into the same region fails;
+  see 'sfm mk -h' Previews for copies which can live alongside.
+
+Flags
+  -h                  display this help
+  -to-region <region> create dst in this region, default the same region
+  -p <string>         a list of key/value pairs separated by commas and
+                      equals which override src's parameters
+  -pf <file>          a path to a params file (see 'sfm mk -h'); can be
+                      supplied more than once, -p overrides it
+  -s3 <s3://bucket/prefix>
+                      where to upload src's template if it is larger than
+                      the 51,200 bytes cloudformation takes as a body; the
+                      bucket must be in dst's region
+  -wait <style>       block on the operation with either 'dots' or 'events'
+                      default behaviour is 'events'
+  -nowait             dont block on the operation
+  <src>               the name of the stack to copy
+  <dst>               the name of the new stack
+`
+
+const usageExportDef = `usage: sfm export-def [-h] <name>
+
+Summary
+  export-def prints a self-contained yaml definition of the stack: its
+  current template, parameters, tags, stack policy and options (caps, sns,
+  role, timeout, norb, protect, alarms, monitor). 'sfm mk -def' makes a
+  stack from it, eg. as a backup or to move the stack to another account:
+
+    sfm export-def foobar > foobar.def.yml
+    sfm -r us-east-1 mk -def foobar.def.yml -p DbPassword=...
+
+  cloudformation doesn't give back NoEcho parameters; their values are
+  'sfm:noecho' in the definition and mk requires them with -p or -pf.
+
+Flags
+  -h      display this help
+  <name>  the name of the stack
+`
+
+const usageExports = `usage: sfm exports [-h] [-e encoding] [<glob>]
+
+Summary
+  prints the exports in the region, tab-sep: <name> <value> <stack>.
+
+Flags
+  -h             display this help
+  -e <encoding>  encode the output (default 'text')
+                 supports 'yaml','json','text'; 'text' is tab-sep
+  <glob>         filter export names by glob (see Go filepath.Match)
+`
+
+const usageImports = `usage: sfm imports [-h] [-e encoding] <export>
+
+Summary
+  prints the names of the stacks which import the export, one per line.
+  an export which isn't imported prints nothing.
+
+Flags
+  -h             display this help
+  -e <encoding>  encode the output (default 'text')
+                 supports 'yaml','json','text'
+  <export>       the name of the export
+`
+
 const usageStat = `usage: sfm stat [-h] [-o|-p|-t|-r] [-e encoding] <name>
 
 Flags
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+)
+
+// mv steps, recorded in the checkpoint as they complete.
+const (
+	mvPlanned  = iota // templates and identifiers worked out, nothing changed
+	mvRetained        // source resources have DeletionPolicy Retain
+	mvRemoved         // resources are out of the source stack
+	mvImported        // resources are in the destination stack
+)
+
+// mvState is the checkpoint of a move. Everything a later step needs is
+// worked out before the first step, as the resources can't be looked up in
+// the source stack once they have been removed from it.
+type mvState struct {
+	Src       string
+	Dst       string
+	Resources []string
+	Step      int
+
+	RetainBody  string // source template with DeletionPolicy Retain
+	RemoveBody  string // source template without the resources
+	DstBody     string // destination template with the resources
+	Identifiers []sfm.ImportResource
+}
+
+func (s stack) mv(args []string, tmpl, mapFile string, yes bool, wait string, nowait bool) int {
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "mv requires the source stack, the destination stack and one or more logical ids")
+		fmt.Print(usageMove)
+		return 64
+	}
+	src, dst, ids := args[0], args[1], args[2:]
+	dots := wait == "dots"
+	events := wait == "events" || (!nowait && !dots)
+	checkpoint := fmt.Sprintf(".sfm-mv-%s-%s.json", src, dst)
+
+	st := mvState{}
+	if b, err := os.ReadFile(checkpoint); err == nil {
+		if err := json.Unmarshal(b, &st); err != nil {
+			fmt.Fprintf(os.Stderr, "cant read checkpoint '%s': %v\n", checkpoint, err)
+			return 66
+		}
+		if strings.Join(st.Resources, ",") != strings.Join(ids, ",") {
+			fmt.Fprintf(os.Stderr, "checkpoint '%s' is for moving %s; finish that move or remove the checkpoint\n", checkpoint, strings.Join(st.Resources, ", "))
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "resuming move from checkpoint '%s'\n", checkpoint)
+	} else {
+		var err error
+		if st, err = s.planMove(src, dst, ids, tmpl, mapFile); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		for _, r := range st.Identifiers {
+			fmt.Fprintf(os.Stderr, "move %-30s %-30s %v\n", r.LogicalID, r.Type, r.Identifier)
+		}
+		if !yes && !confirm(fmt.Sprintf("move %d resources from '%s' to '%s'?", len(ids), src, dst)) {
+			fmt.Fprintln(os.Stderr, "not moving; use -yes to move without asking")
+			return 1
+		}
+		if err := saveMove(checkpoint, st); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+
+	for st.Step < mvImported {
+		var err error
+		switch st.Step {
+		case mvPlanned:
+			fmt.Fprintf(os.Stderr, "setting DeletionPolicy Retain in '%s'\n", src)
+			err = s.updateTemplate(src, st.RetainBody, dots, events)
+		case mvRetained:
+			fmt.Fprintf(os.Stderr, "removing resources from '%s'\n", src)
+			err = s.updateTemplate(src, st.RemoveBody, dots, events)
+		case mvRemoved:
+			fmt.Fprintf(os.Stderr, "importing resources into '%s'\n", dst)
+			err = s.importInto(dst, st.DstBody, st.Identifiers, dots, events)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			fmt.Fprintf(os.Stderr, "move stopped; fix the problem and run the same mv again to resume\n")
+			return 1
+		}
+		st.Step++
+		if err := saveMove(checkpoint, st); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+
+	if err := os.Remove(checkpoint); err != nil {
+		fmt.Fprintf(os.Stderr, "WARN cant remove checkpoint: %v\n", err)
+	}
+	if isPiped() {
+		fmt.Println(dst)
+	}
+	return 0
+}
+
+// planMove works out the templates for each step of a move and the
+// identifiers of the resources, checking nothing is left referring to a
+// resource which isn't there.
+func (s stack) planMove(src, dst string, ids []string, tmpl, mapFile string) (mvState, error) {
+	h := sfm.Handle{CFNcli: s.cli}
+	st := mvState{Src: src, Dst: dst, Resources: ids}
+
+	body, err := h.GetTemplate(src)
+	if err != nil {
+		return st, err
+	}
+	retain, err := sfm.ParseTemplate([]byte(body))
+	if err != nil {
+		return st, fmt.Errorf("cant parse '%s' template: %w", src, err)
+	}
+	remove, _ := sfm.ParseTemplate([]byte(body))
+	res := retain.Section("Resources")
+	moved := map[string]*sfm.Node{}
+	for _, id := range ids {
+		r := res.Get(id)
+		if r == nil {
+			return st, fmt.Errorf("'%s' is not a resource in '%s'", id, src)
+		}
+		r.Set("DeletionPolicy", sfm.NewScalar("Retain"))
+		moved[id] = r.Clone()
+		remove.Section("Resources").Delete(id)
+	}
+	if err := undefinedRefs(remove, "the source stack without the resources"); err != nil {
+		return st, err
+	}
+
+	// the destination template, either supplied or the current template
+	// with the resources added
+	var dd *sfm.Doc
+	switch {
+	case tmpl != "":
+		b, err := s.readTemplate(tmpl)
+		if err != nil {
+			return st, err
+		}
+		if dd, err = sfm.ParseTemplate(b); err != nil {
+			return st, fmt.Errorf("cant parse template: %w", err)
+		}
+		for _, id := range ids {
+			if dd.Section("Resources").Get(id).Get("DeletionPolicy") == nil {
+				return st, fmt.Errorf("'%s' must be in the destination template with a DeletionPolicy", id)
+			}
+		}
+	default:
+		dbody, err := h.GetTemplate(dst)
+		if err != nil {
+			dbody = `{"Resources":{}}` // the import creates the stack
+		}
+		if dd, err = sfm.ParseTemplate([]byte(dbody)); err != nil {
+			return st, fmt.Errorf("cant parse '%s' template: %w", dst, err)
+		}
+		if dd.Section("Resources") == nil {
+			dd.Root.Set("Resources", sfm.NewMap())
+		}
+		for _, id := range ids {
+			if dd.Section("Resources").Get(id) != nil {
+				return st, fmt.Errorf("'%s' is already a resource in '%s'", id, dst)
+			}
+			dd.Section("Resources").Set(id, moved[id])
+		}
+	}
+	if err := undefinedRefs(dd, "the destination stack with the resources; supply its template with -t"); err != nil {
+		return st, err
+	}
+
+	for k, d := range map[*string]*sfm.Doc{&st.RetainBody: retain, &st.RemoveBody: remove, &st.DstBody: dd} {
+		b, err := d.Marshal()
+		if err != nil {
+			return st, fmt.Errorf("cant marshal template: %w", err)
+		}
+		*k = string(b)
+	}
+
+	// the physical ids of the resources identify them, unless mapped
+	mapped := map[string]sfm.ImportResource{}
+	if mapFile != "" {
+		rr, err := s.importResources(st.DstBody, mapFile)
+		if err != nil {
+			return st, err
+		}
+		for _, r := range rr {
+			mapped[r.LogicalID] = r
+		}
+	}
+	x, err := h.Get(src)
+	if err != nil {
+		return st, err
+	}
+	mm, err := x.AllResources()
+	if err != nil {
+		return st, err
+	}
+	for _, id := range ids {
+		if _, ok := mm[id]; !ok {
+			return st, fmt.Errorf("resource '%s' is not in stack '%s'", id, src)
+		}
+		r, ok := mapped[id]
+		if !ok {
+			r = sfm.ImportResource{LogicalID: id, Type: mm[id]["type"]}
+			if r.Identifier, err = h.Identify(st.DstBody, r.Type, mm[id]["pid"]); err != nil {
+				return st, fmt.Errorf("cant identify '%s', map it with -map: %w", id, err)
+			}
+		}
+		r.Type = mm[id]["type"]
+		st.Identifiers = append(st.Identifiers, r)
+	}
+	return st, nil
+}
+
+// undefinedRefs returns an error if the template refers to anything which
+// isn't defined.
+func undefinedRefs(d *sfm.Doc, what string) error {
+	msgs := []string{}
+	for _, f := range sfm.Lint(d) {
+		if f.Level == sfm.LevelError && strings.HasPrefix(f.Rule, "undefined-") {
+			msgs = append(msgs, f.Path+": "+f.Message)
+		}
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("%s would have undefined references:\n  %s", what, strings.Join(msgs, "\n  "))
+	}
+	return nil
+}
+
+// updateTemplate updates the stack with a new template, keeping its
+// parameters and tags, and blocks until the update is done.
+func (s stack) updateTemplate(name, body string, dots, events bool) error {
+	h := sfm.Handle{CFNcli: s.cli}
+	cur, err := h.Get(name)
+	if err != nil {
+		return err
+	}
+	x := sfm.Stack{Name: name, Tags: cur.Tags, Topics: cur.Topics, KeepParams: true, Handle: h}
+	if err := x.NewTemplate([]byte(body)); err != nil {
+		return err
+	}
+	if _, err := h.Make(x); err != nil {
+		return err
+	}
+	err = s.block(name, dots, events)
+	if dots || events {
+		fmt.Println()
+	}
+	return err
+}
+
+// importInto imports the resources into the stack and blocks until the
+// import is done.
+func (s stack) importInto(name, body string, rr []sfm.ImportResource, dots, events bool) error {
+	h := sfm.Handle{CFNcli: s.cli}
+	x := sfm.Stack{Name: name, Handle: h}
+	if cur, err := h.Get(name); err == nil {
+		x.Tags = cur.Tags
+	}
+	if err := x.NewTemplate([]byte(body)); err != nil {
+		return err
+	}
+	cs, cc, err := h.Import(x, rr)
+	if err != nil {
+		return err
+	}
+	printChanges(cc)
+	if _, err := h.ExecuteChangeSet(name, cs); err != nil {
+		return err
+	}
+	err = s.block(name, dots, events)
+	if dots || events {
+		fmt.Println()
+	}
+	return err
+}
+
+func saveMove(fn string, st mvState) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cant marshal checkpoint: %w", err)
+	}
+	if err := os.WriteFile(filepath.Clean(fn), b, 0600); err != nil {
+		return fmt.Errorf("cant write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kvFile is the content of a parameters or tags file. Flat, .env and AWS CLI
+// parameter documents populate Params, AWS CLI tag lists populate Tags, and
+// CodePipeline template configuration documents may populate all three.
+// Flat is set for flat and .env documents, whose Params are just keys and
+// values and can be used as tags.
+type kvFile struct {
+	Params map[string]string
+	Tags   map[string]string
+	Policy string
+	Flat   bool
+}
+
+// loadParams loads the parameter files in order, later keys overwrite
+// earlier ones, then the params string of k=v pairs separated by commas.
+func loadParams(pFiles []string, params string) (kvFile, error) {
+	kv := kvFile{Params: map[string]string{}, Tags: map[string]string{}}
+	for _, f := range pFiles {
+		pf, err := loadKVFile(f)
+		if err != nil {
+			return kv, fmt.Errorf("cant load params file '%s': %w", f, err)
+		}
+		for k, v := range pf.Params {
+			kv.Params[k] = v
+		}
+		for k, v := range pf.Tags {
+			kv.Tags[k] = v
+		}
+		if pf.Policy != "" {
+			kv.Policy = pf.Policy
+		}
+	}
+	for _, kvp := range strings.Split(params, ",") {
+		if kvp == "" {
+			continue
+		}
+		els := strings.SplitN(kvp, "=", 2)
+		if len(els) != 2 {
+			fmt.Fprintf(os.Stderr, "param kvp '%v' missing '=' splitter, ignoring\n", kvp)
+			continue
+		}
+		kv.Params[els[0]] = els[1]
+	}
+	return kv, nil
+}
+
+// loadKVFile reads fn and auto-detects its shape. Supported shapes are:
+//
+//	flat         {"key": "value", ...}
+//	aws cli      [{"ParameterKey": "key", "ParameterValue": "value"}, ...]
+//	             [{"Key": "key", "Value": "value"}, ...]
+//	codepipeline {"Parameters": {...}, "Tags": {...}, "StackPolicy": {...}}
+//	dotenv       KEY=value lines
+func loadKVFile(fn string) (kvFile, error) {
+	f := kvFile{Params: map[string]string{}, Tags: map[string]string{}, Flat: true}
+	if fn == "" {
+		// You didn't give me a file path so I won't do anything
+		return f, nil
+	}
+	bb, err := os.ReadFile(filepath.Clean(fn))
+	if err != nil {
+		return f, fmt.Errorf("can't read file %s: %w", fn, err)
+	}
+
+	if isDotEnv(fn) {
+		f.Params, err = parseDotEnv(bb)
+		if err != nil {
+			return f, fmt.Errorf("can't load env file %s: %w", fn, err)
+		}
+		return f, nil
+	}
+
+	var doc yaml.Node
+	err = yaml.Unmarshal(bb, &doc)
+	if err != nil {
+		return f, fmt.Errorf("can't unmarshal file %s: %w", fn, err)
+	}
+	if len(doc.Content) == 0 {
+		return f, nil
+	}
+
+	n := resolve(doc.Content[0])
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return f, nil
+		}
+		// a KEY=value document without a .env extension looks like a
+		// single multi-line scalar to the yaml parser
+		f.Params, err = parseDotEnv(bb)
+	case yaml.SequenceNode:
+		f.Flat = false
+		f.Params, f.Tags, err = fromAWSList(n)
+	case yaml.MappingNode:
+		if isPipelineConfig(n) {
+			f, err = fromPipelineConfig(n)
+			break
+		}
+		f.Params, err = fromFlatMap(n)
+	default:
+		err = errors.New("unsupported document type")
+	}
+	if err != nil {
+		return f, fmt.Errorf("can't load file %s: %w", fn, err)
+	}
+	return f, nil
+}
+
+func isDotEnv(fn string) bool {
+	b := filepath.Base(fn)
+	return filepath.Ext(b) == ".env" || strings.HasPrefix(b, ".env")
+}
+
+// parseDotEnv parses KEY=value lines. Blank lines, comments and a leading
+// 'export' are ignored, and matching outer quotes are stripped from values.
+func parseDotEnv(bb []byte) (map[string]string, error) {
+	res := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(bb))
+	n := 0
+	for sc.Scan() {
+		n++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=value", n)
+		}
+		v = strings.TrimSpace(v)
+		if len(v) > 1 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			if v[0] == '"' {
+				uq, err := strconv.Unquote(v)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: bad quoted value: %w", n, err)
+				}
+				v = uq
+			} else {
+				v = v[1 : len(v)-1]
+			}
+		}
+		res[k] = v
+	}
+	return res, sc.Err()
+}
+
+// fromAWSList handles the list forms accepted by the aws cli for
+// --parameters and --tags.
+func fromAWSList(l *yaml.Node) (map[string]string, map[string]string, error) {
+	params := map[string]string{}
+	tags := map[string]string{}
+	for i, el := range l.Content {
+		el = resolve(el)
+		if el.Kind != yaml.MappingNode {
+			return nil, nil, fmt.Errorf("list element %d (line %d) is not a map", i, el.Line)
+		}
+		if k := lookup(el, "ParameterKey"); k != nil {
+			key, err := scalar(k)
+			if err != nil {
+				return nil, nil, fmt.Errorf("list element %d: ParameterKey: %w", i, err)
+			}
+			if prev := lookup(el, "UsePreviousValue"); prev != nil && prev.Value == "true" {
+				// mk uses the previous value for any param which isn't supplied
+				continue
+			}
+			pv := lookup(el, "ParameterValue")
+			if pv == nil {
+				// an empty value would silently overwrite the stack's
+				return nil, nil, fmt.Errorf("parameter %s has neither a ParameterValue nor UsePreviousValue true", key)
+			}
+			val, err := value(pv)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parameter %s: %w", key, err)
+			}
+			params[key] = val
+			continue
+		}
+		if k := lookup(el, "Key"); k != nil {
+			key, err := scalar(k)
+			if err != nil {
+				return nil, nil, fmt.Errorf("list element %d: Key: %w", i, err)
+			}
+			val, err := scalar(lookup(el, "Value"))
+			if err != nil {
+				return nil, nil, fmt.Errorf("tag %s: %w", key, err)
+			}
+			tags[key] = val
+			continue
+		}
+		return nil, nil, fmt.Errorf("list element %d (line %d) has neither a ParameterKey nor a Key", i, el.Line)
+	}
+	return params, tags, nil
+}
+
+// isPipelineConfig reports whether m looks like a CodePipeline template
+// configuration file, ie. only has the known sections and at least one of
+// them is a map.
+func isPipelineConfig(m *yaml.Node) bool {
+	if len(m.Content) == 0 {
+		return false
+	}
+	nested := false
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		switch m.Content[i].Value {
+		case "Parameters", "Tags", "StackPolicy":
+		default:
+			return false
+		}
+		if resolve(m.Content[i+1]).Kind == yaml.MappingNode {
+			nested = true
+		}
+	}
+	return nested
+}
+
+func fromPipelineConfig(m *yaml.Node) (kvFile, error) {
+	f := kvFile{Params: map[string]string{}, Tags: map[string]string{}}
+	var err error
+	if v := lookup(m, "Parameters"); v != nil && v.Tag != "!!null" {
+		if v.Kind != yaml.MappingNode {
+			return f, errors.New("Parameters is not a map")
+		}
+		if f.Params, err = fromFlatMap(v); err != nil {
+			return f, fmt.Errorf("Parameters: %w", err)
+		}
+	}
+	if v := lookup(m, "Tags"); v != nil && v.Tag != "!!null" {
+		if v.Kind != yaml.MappingNode {
+			return f, errors.New("Tags is not a map")
+		}
+		if f.Tags, err = fromFlatMap(v); err != nil {
+			return f, fmt.Errorf("Tags: %w", err)
+		}
+	}
+	if v := lookup(m, "StackPolicy"); v != nil && v.Tag != "!!null" {
+		var i interface{}
+		if err := v.Decode(&i); err != nil {
+			return f, fmt.Errorf("cant decode StackPolicy: %w", err)
+		}
+		b, err := json.Marshal(i)
+		if err != nil {
+			return f, fmt.Errorf("cant marshal StackPolicy to json: %w", err)
+		}
+		f.Policy = string(b)
+	}
+	return f, nil
+}
+
+func fromFlatMap(m *yaml.Node) (map[string]string, error) {
+	res := map[string]string{}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		key, err := scalar(m.Content[i])
+		if err != nil {
+			return nil, fmt.Errorf("key on line %d: %w", m.Content[i].Line, err)
+		}
+		val, err := value(m.Content[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key, err)
+		}
+		res[key] = val
+	}
+	return res, nil
+}
+
+// value returns the literal text of a scalar node, or the comma-joined
+// literal text of a list of scalars which suits CommaDelimitedList params.
+func value(n *yaml.Node) (string, error) {
+	n = resolve(n)
+	if n != nil && n.Kind == yaml.SequenceNode {
+		vals := []string{}
+		for _, el := range n.Content {
+			val, err := scalar(el)
+			if err != nil {
+				return "", fmt.Errorf("list element on line %d: %w", el.Line, err)
+			}
+			vals = append(vals, val)
+		}
+		return strings.Join(vals, ","), nil
+	}
+	return scalar(n)
+}
+
+// scalar returns the text of a scalar node exactly as it appears in the
+// source document, so 'yes', '1.50' and '2024-01-01' are not reinterpreted
+// as a bool, float or timestamp.
+func scalar(n *yaml.Node) (string, error) {
+	n = resolve(n)
+	if n == nil {
+		return "", nil
+	}
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return "", nil
+		}
+		return n.Value, nil
+	case yaml.MappingNode:
+		return "", fmt.Errorf("nested maps are not supported (line %d)", n.Line)
+	case yaml.SequenceNode:
+		return "", fmt.Errorf("nested lists are not supported (line %d)", n.Line)
+	}
+	return "", fmt.Errorf("unsupported value (line %d)", n.Line)
+}
+
+// resolve follows aliases to the node they refer to.
+func resolve(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// lookup returns the value node for key in the mapping node m, or nil.
+func lookup(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return resolve(m.Content[i+1])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadKVFile(t *testing.T) {
+	tt := []struct {
+		name   string
+		file   string
+		body   string
+		params map[string]string
+		tags   map[string]string
+		policy string
+		err    string
+	}{
+		{
+			name:   "bools kept as written",
+			file:   "p.yml",
+			body:   "A: yes\nB: true\nC: True\nD: off\n",
+			params: map[string]string{"A": "yes", "B": "true", "C": "True", "D": "off"},
+		},
+		{
+			name:   "numbers and dates kept literal",
+			file:   "p.yml",
+			body:   "A: 1.50\nB: 0x1F\nC: 2024-01-01\nD: 007\nE: 1e3\n",
+			params: map[string]string{"A": "1.50", "B": "0x1F", "C": "2024-01-01", "D": "007", "E": "1e3"},
+		},
+		{
+			name:   "nulls are empty",
+			file:   "p.yml",
+			body:   "A: ~\nB: null\nC:\n",
+			params: map[string]string{"A": "", "B": "", "C": ""},
+		},
+		{
+			name:   "empty document",
+			file:   "p.yml",
+			body:   "",
+			params: map[string]string{},
+		},
+		{
+			name:   "null document",
+			file:   "p.yml",
+			body:   "~\n",
+			params: map[string]string{},
+		},
+		{
+			name:   "lists joined for CommaDelimitedList",
+			file:   "p.yml",
+			body:   "A: [true, no, 1.50, 0x1F]\nB:\n  - a\n  - ~\n  - c\n",
+			params: map[string]string{"A": "true,no,1.50,0x1F", "B": "a,,c"},
+		},
+		{
+			name:   "json flat map",
+			file:   "p.json",
+			body:   `{"A": "x", "B": 1.50, "C": [1, 2]}`,
+			params: map[string]string{"A": "x", "B": "1.50", "C": "1,2"},
+		},
+		{
+			name:   "anchors and aliases",
+			file:   "p.yml",
+			body:   "A: &env prod\nB: *env\nC: &azs [a, b]\nD: *azs\n",
+			params: map[string]string{"A": "prod", "B": "prod", "C": "a,b", "D": "a,b"},
+		},
+		{
+			name: "nested map",
+			file: "p.yml",
+			body: "A:\n  B: c\n",
+			err:  "nested maps are not supported",
+		},
+		{
+			name: "nested list",
+			file: "p.yml",
+			body: "A: [[a, b], c]\n",
+			err:  "nested lists are not supported",
+		},
+		{
+			name: "map in a list",
+			file: "p.yml",
+			body: "A:\n  - B: c\n",
+			err:  "nested maps are not supported",
+		},
+		{
+			name: "map key",
+			file: "p.yml",
+			body: "? [a, b]\n: c\n",
+			err:  "nested lists are not supported",
+		},
+		{
+			name: "aws cli parameters",
+			file: "p.json",
+			body: `[
+				{"ParameterKey": "A", "ParameterValue": "1.50"},
+				{"ParameterKey": "B", "UsePreviousValue": true},
+				{"ParameterKey": "C", "ParameterValue": "x", "UsePreviousValue": false},
+				{"ParameterKey": "D", "ParameterValue": ["a", "b"]}
+			]`,
+			params: map[string]string{"A": "1.50", "C": "x", "D": "a,b"},
+			tags:   map[string]string{},
+		},
+		{
+			name:   "aws cli tags",
+			file:   "t.json",
+			body:   `[{"Key": "team", "Value": "ops"}, {"Key": "cost", "Value": 0100}]`,
+			params: map[string]string{},
+			tags:   map[string]string{"team": "ops", "cost": "0100"},
+		},
+		{
+			name: "aws cli list of scalars",
+			file: "p.json",
+			body: `["A", "B"]`,
+			err:  "list element 0 (line 1) is not a map",
+		},
+		{
+			name: "aws cli list without keys",
+			file: "p.json",
+			body: `[{"Name": "A"}]`,
+			err:  "has neither a ParameterKey nor a Key",
+		},
+		{
+			name: "aws cli parameter without a value",
+			file: "p.json",
+			body: `[{"ParameterKey": "A", "ParameterValue": "x"}, {"ParameterKey": "B"}]`,
+			err:  "parameter B has neither a ParameterValue nor UsePreviousValue true",
+		},
+		{
+			name: "aws cli parameter without a value or previous value",
+			file: "p.json",
+			body: `[{"ParameterKey": "A", "UsePreviousValue": false}]`,
+			err:  "parameter A has neither a ParameterValue nor UsePreviousValue true",
+		},
+		{
+			name:   "aws cli parameter with an empty value",
+			file:   "p.json",
+			body:   `[{"ParameterKey": "A", "ParameterValue": ""}]`,
+			params: map[string]string{"A": ""},
+		},
+		{
+			name: "aws cli nested value",
+			file: "p.json",
+			body: `[{"ParameterKey": "A", "ParameterValue": {"B": "c"}}]`,
+			err:  "parameter A: nested maps are not supported",
+		},
+		{
+			name: "codepipeline",
+			file: "config.json",
+			body: `{
+				"Parameters": {"A": "yes", "B": [1, 2]},
+				"Tags": {"team": "ops"},
+				"StackPolicy": {"Statement": [{"Effect": "Allow", "Action": "Update:*", "Principal": "*", "Resource": "*"}]}
+			}`,
+			params: map[string]string{"A": "yes", "B": "1,2"},
+			tags:   map[string]string{"team": "ops"},
+			policy: `{"Statement":[{"Action":"Update:*","Effect":"Allow","Principal":"*","Resource":"*"}]}`,
+		},
+		{
+			name:   "codepipeline tags only",
+			file:   "config.yml",
+			body:   "Parameters: ~\nTags:\n  team: ops\n",
+			params: map[string]string{},
+			tags:   map[string]string{"team": "ops"},
+		},
+		{
+			name:   "flat map with a Parameters key",
+			file:   "p.yml",
+			body:   "Parameters: x\nTags: y\n",
+			params: map[string]string{"Parameters": "x", "Tags": "y"},
+		},
+		{
+			name: "codepipeline parameters not a map",
+			file: "config.yml",
+			body: "Parameters: [a]\nTags:\n  team: ops\n",
+			err:  "Parameters is not a map",
+		},
+		{
+			name:   "dotenv",
+			file:   "stack.env",
+			body:   "# comment\n\nexport A=1.50\nB = \"x\\ty\"\nC='a b'\nD=\"it's\"\nE=x=y\nF=\nG=yes\n",
+			params: map[string]string{"A": "1.50", "B": "x\ty", "C": "a b", "D": "it's", "E": "x=y", "F": "", "G": "yes"},
+		},
+		{
+			name:   "dotenv by name",
+			file:   ".env.prod",
+			body:   "A=1\n",
+			params: map[string]string{"A": "1"},
+		},
+		{
+			name: "dotenv missing =",
+			file: "stack.env",
+			body: "A=1\nB\n",
+			err:  "line 2: expected KEY=value",
+		},
+		{
+			name: "dotenv bad quoting",
+			file: "stack.env",
+			body: "A=\"\\q\"\n",
+			err:  "line 1: bad quoted value",
+		},
+		{
+			name:   "KEY=value without .env extension",
+			file:   "params.txt",
+			body:   "A=1.50\nexport B=\"x y\"\n",
+			params: map[string]string{"A": "1.50", "B": "x y"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			fn := filepath.Join(t.TempDir(), tc.file)
+			if err := os.WriteFile(fn, []byte(tc.body), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			f, err := loadKVFile(fn)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("want error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(f.Params, tc.params) {
+				t.Errorf("params: want %v, got %v", tc.params, f.Params)
+			}
+			if tc.tags == nil {
+				tc.tags = map[string]string{}
+			}
+			if !maps.Equal(f.Tags, tc.tags) {
+				t.Errorf("tags: want %v, got %v", tc.tags, f.Tags)
+			}
+			if f.Policy != tc.policy {
+				t.Errorf("policy: want %s, got %s", tc.policy, f.Policy)
+			}
+		})
+	}
+}
+
+func TestLoadKVFileFlat(t *testing.T) {
+	tt := []struct {
+		file string
+		body string
+		flat bool
+	}{
+		{file: "p.yml", body: "A: x\n", flat: true},
+		{file: "p.env", body: "A=x\n", flat: true},
+		{file: "p.txt", body: "A=x\n", flat: true},
+		{file: "p.json", body: `[{"ParameterKey": "A", "ParameterValue": "x"}]`},
+		{file: "t.json", body: `[{"Key": "A", "Value": "x"}]`},
+		{file: "config.json", body: `{"Parameters": {"A": "x"}, "Tags": {"B": "y"}}`},
+	}
+	for _, tc := range tt {
+		fn := filepath.Join(t.TempDir(), tc.file)
+		if err := os.WriteFile(fn, []byte(tc.body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		f, err := loadKVFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Flat != tc.flat {
+			t.Errorf("%s: want flat %v, got %v", tc.body, tc.flat, f.Flat)
+		}
+	}
+}
+
+func TestLoadKVFileMissing(t *testing.T) {
+	f, err := loadKVFile("")
+	if err != nil || len(f.Params) != 0 {
+		t.Errorf("want no params and no error for no file, got %v, %v", f.Params, err)
+	}
+	if _, err := loadKVFile(filepath.Join(t.TempDir(), "nope.yml")); err == nil {
+		t.Error("want an error for a missing file")
+	}
+}
+
+func TestValue(t *testing.T) {
+	tt := []struct {
+		yaml string
+		want string
+		err  string
+	}{
+		{yaml: "yes", want: "yes"},
+		{yaml: "True", want: "True"},
+		{yaml: "1.50", want: "1.50"},
+		{yaml: "0x1F", want: "0x1F"},
+		{yaml: "2024-01-01", want: "2024-01-01"},
+		{yaml: "'quoted: yes'", want: "quoted: yes"},
+		{yaml: "~", want: ""},
+		{yaml: "[]", want: ""},
+		{yaml: "[true, false]", want: "true,false"},
+		{yaml: "[1, 2.0, 0o17]", want: "1,2.0,0o17"},
+		{yaml: "[a, [b]]", err: "nested lists are not supported"},
+		{yaml: "[a, {b: c}]", err: "nested maps are not supported"},
+		{yaml: "{a: b}", err: "nested maps are not supported"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.yaml, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tc.yaml), &doc); err != nil {
+				t.Fatal(err)
+			}
+			got, err := value(doc.Content[0])
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("want error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestScalar(t *testing.T) {
+	tt := []struct {
+		yaml string
+		want string
+		err  string
+	}{
+		{yaml: "yes", want: "yes"},
+		{yaml: "1.50", want: "1.50"},
+		{yaml: "null", want: ""},
+		{yaml: "[a, b]", err: "nested lists are not supported"},
+		{yaml: "{a: b}", err: "nested maps are not supported"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.yaml, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tc.yaml), &doc); err != nil {
+				t.Fatal(err)
+			}
+			got, err := scalar(doc.Content[0])
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("want error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+	if got, err := scalar(nil); got != "" || err != nil {
+		t.Errorf("nil node: want \"\", nil, got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,170 @@
+package sfm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfn "github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cfntyp "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/google/uuid"
+)
+
+// ImportResource is an existing resource to import into a stack.
+type ImportResource struct {
+	LogicalID  string
+	Type       string
+	Identifier map[string]string // e.g. BucketName: my-bucket
+}
+
+// Change is a change a change set will make to a stack.
+type Change struct {
+	Action      string // Add, Modify, Remove, Import, Dynamic
+	LogicalID   string
+	PhysicalID  string
+	Type        string
+	Replacement string
+}
+
+// Import creates an IMPORT change set which brings the resources into the
+// stack, creating the stack if it doesn't exist, and returns the change set's
+// name and changes once it is ready to execute. The stack's template must
+// declare the resources with a DeletionPolicy.
+func (h Handle) Import(s Stack, rr []ImportResource) (string, []Change, error) {
+	if s.Name == "" {
+		return "", nil, errors.New("missing stack name")
+	}
+	if len(s.TemplateBody) < 1 {
+		return "", nil, errors.New("stack has empty template")
+	}
+	if len(rr) < 1 {
+		return "", nil, errors.New("no resources to import")
+	}
+
+	toImport := []cfntyp.ResourceToImport{}
+	for _, r := range rr {
+		res, ok := s.Template.Resources[r.LogicalID].(map[string]interface{})
+		if !ok {
+			return "", nil, fmt.Errorf("resource '%s' is not in the template", r.LogicalID)
+		}
+		if _, ok := res["DeletionPolicy"]; !ok {
+			return "", nil, fmt.Errorf("resource '%s' must declare a DeletionPolicy to be imported", r.LogicalID)
+		}
+		if t, _ := res["Type"].(string); r.Type == "" {
+			r.Type = t
+		}
+		toImport = append(toImport, cfntyp.ResourceToImport{
+			LogicalResourceId:  aws.String(r.LogicalID),
+			ResourceType:       aws.String(r.Type),
+			ResourceIdentifier: r.Identifier,
+		})
+	}
+
+	cs := "sfm-import-" + uuid.NewString()[:8]
+	i := &cfn.CreateChangeSetInput{
+		StackName:         aws.String(s.Name),
+		ChangeSetName:     aws.String(cs),
+		ChangeSetType:     cfntyp.ChangeSetTypeImport,
+		Capabilities:      h.caps(s),
+		Parameters:        h.updateParams(s),
+		TemplateBody:      aws.String(s.TemplateBody),
+		ResourcesToImport: toImport,
+	}
+	if len(s.Tags) > 0 {
+		i.Tags = s.tagsToAWS()
+	}
+	if s.RoleARN != "" {
+		i.RoleARN = aws.String(s.RoleARN)
+	}
+	if _, err := h.CFNcli.CreateChangeSet(context.Background(), i); err != nil {
+		return "", nil, fmt.Errorf("cant create import change set: %w", err)
+	}
+
+	cc, err := h.changes(s.Name, cs)
+	return cs, cc, err
+}
+
+// changes waits for the change set to be created and returns its changes.
+func (h Handle) changes(stack, cs string) ([]Change, error) {
+	di := &cfn.DescribeChangeSetInput{StackName: aws.String(stack), ChangeSetName: aws.String(cs)}
+	w := cfn.NewChangeSetCreateCompleteWaiter(h.CFNcli)
+	if err := w.Wait(context.Background(), di, 30*time.Minute); err != nil {
+		if o, derr := h.CFNcli.DescribeChangeSet(context.Background(), di); derr == nil && o.StatusReason != nil {
+			return nil, fmt.Errorf("change set failed: %s", *o.StatusReason)
+		}
+		return nil, fmt.Errorf("cant wait on change set: %w", err)
+	}
+
+	cc := []Change{}
+	for {
+		o, err := h.CFNcli.DescribeChangeSet(context.Background(), di)
+		if err != nil {
+			return nil, fmt.Errorf("cant describe change set: %w", err)
+		}
+		for _, c := range o.Changes {
+			rc := c.ResourceChange
+			if rc == nil {
+				continue
+			}
+			cc = append(cc, Change{
+				Action:      string(rc.Action),
+				LogicalID:   str(rc.LogicalResourceId),
+				PhysicalID:  str(rc.PhysicalResourceId),
+				Type:        str(rc.ResourceType),
+				Replacement: string(rc.Replacement),
+			})
+		}
+		if o.NextToken == nil {
+			break
+		}
+		di.NextToken = o.NextToken
+	}
+	sort.Slice(cc, func(i, j int) bool { return cc[i].LogicalID < cc[j].LogicalID })
+	return cc, nil
+}
+
+// ExecuteChangeSet executes the named change set and returns a
+// ClientRequestToken and an error.
+func (h Handle) ExecuteChangeSet(stack, cs string) (string, error) {
+	token := uuid.NewString()
+	_, err := h.CFNcli.ExecuteChangeSet(context.Background(), &cfn.ExecuteChangeSetInput{
+		StackName:          aws.String(stack),
+		ChangeSetName:      aws.String(cs),
+		ClientRequestToken: &token,
+	})
+	if err != nil {
+		return token, fmt.Errorf("cant execute change set: %w", err)
+	}
+	return token, nil
+}
+
+// DeleteChangeSet deletes the named change set.
+func (h Handle) DeleteChangeSet(stack, cs string) error {
+	_, err := h.CFNcli.DeleteChangeSet(context.Background(), &cfn.DeleteChangeSetInput{
+		StackName:     aws.String(stack),
+		ChangeSetName: aws.String(cs),
+	})
+	if err != nil {
+		return fmt.Errorf("cant delete change set: %w", err)
+	}
+	return nil
+}
+
+// Identify returns the identifier of an existing resource of type typ from
+// the single value which identifies it, e.g. a bucket's name. The template
+// body supplies the identifier's property name, types identified by more
+// than one property need a full identifier.
+func (h Handle) Identify(body, typ, value string) (map[string]string, error) {
+	sum, err := h.Validate(body, "")
+	if err != nil {
+		return nil, err
+	}
+	ids := sum.Identifiers[typ]
+	if len(ids) != 1 {
+		return nil, fmt.Errorf("%s is identified by %v, not a single value", typ, ids)
+	}
+	return map[string]string{ids[0]: value}, nil
+}
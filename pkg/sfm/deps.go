@@ -0,0 +1,249 @@
+package sfm
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfn "github.com/aws/aws-sdk-go-v2/service/cloudformation"
+)
+
+// Export is a value exported by a stack.
+type Export struct {
+	Name  string
+	Value string
+	Stack string
+}
+
+// Dependency is a stack which imports an export of another stack.
+type Dependency struct {
+	Stack    string // the importing stack
+	Export   string
+	Exporter string // the exporting stack
+}
+
+// Vars returns the values a template's names can be worked out from: the
+// parameters, with their defaults, and the AWS::StackName and AWS::Region
+// pseudo parameters.
+func (d *Doc) Vars(stack, region string, params map[string]string) map[string]string {
+	vars := map[string]string{"AWS::StackName": stack}
+	if region != "" {
+		vars["AWS::Region"] = region
+	}
+	if pp := d.Section("Parameters"); pp != nil && pp.Kind == MapNode {
+		for _, k := range pp.Keys {
+			if def := pp.Map[k].Get("Default"); def != nil && def.Kind == ScalarNode {
+				vars[k] = def.Value
+			}
+		}
+	}
+	for k, v := range params {
+		vars[k] = v
+	}
+	return vars
+}
+
+// Exports returns the names the template exports. Names which can't be
+// worked out from vars, e.g. those using AWS::AccountId, are left out.
+func (d *Doc) Exports(vars map[string]string) []string {
+	names := []string{}
+	oo := d.Section("Outputs")
+	if oo == nil || oo.Kind != MapNode {
+		return names
+	}
+	for _, k := range oo.Keys {
+		if name, ok := oo.Map[k].Get("Export").Get("Name").Eval(vars); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Imports returns the export names the template imports with
+// Fn::ImportValue, sorted and without duplicates. Names which can't be
+// worked out from vars are left out.
+func (d *Doc) Imports(vars map[string]string) []string {
+	names := []string{}
+	d.Root.Walk(func(_ []string, n *Node) bool {
+		if n.Kind != FuncNode || n.Func != "Fn::ImportValue" {
+			return true
+		}
+		if name, ok := n.longArg().Eval(vars); ok && !contains(names, name) {
+			names = append(names, name)
+		}
+		return false
+	})
+	sort.Strings(names)
+	return names
+}
+
+// Eval returns the string n evaluates to. Scalars, Ref, Fn::Sub and Fn::Join
+// are evaluated, with vars giving the values of Refs; ok is false for
+// anything else.
+func (n *Node) Eval(vars map[string]string) (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	if n.Kind == ScalarNode {
+		return n.Value, true
+	}
+	if n.Kind != FuncNode {
+		return "", false
+	}
+	arg := n.longArg()
+	switch n.Func {
+	case "Ref":
+		if arg.Kind != ScalarNode {
+			return "", false
+		}
+		v, ok := vars[arg.Value]
+		return v, ok
+	case "Fn::Sub":
+		s, local := arg, NewMap()
+		if arg.Kind == ListNode && len(arg.List) > 0 {
+			s = arg.List[0]
+			if len(arg.List) > 1 && arg.List[1].Kind == MapNode {
+				local = arg.List[1]
+			}
+		}
+		if s.Kind != ScalarNode {
+			return "", false
+		}
+		ok := true
+		v := subVar.ReplaceAllStringFunc(s.Value, func(m string) string {
+			name := strings.TrimSpace(m[2 : len(m)-1])
+			if l := local.Get(name); l != nil {
+				v, lok := l.Eval(vars)
+				ok = ok && lok
+				return v
+			}
+			v, vok := vars[name]
+			ok = ok && vok
+			return v
+		})
+		return strings.ReplaceAll(v, "${!", "${"), ok
+	case "Fn::Join":
+		if arg.Kind != ListNode || len(arg.List) != 2 || arg.List[0].Kind != ScalarNode || arg.List[1].Kind != ListNode {
+			return "", false
+		}
+		parts := []string{}
+		for _, el := range arg.List[1].List {
+			v, ok := el.Eval(vars)
+			if !ok {
+				return "", false
+			}
+			parts = append(parts, v)
+		}
+		return strings.Join(parts, arg.List[0].Value), true
+	}
+	return "", false
+}
+
+// Exports returns the exports in the region with names matching glob.
+func (h Handle) Exports(glob string) ([]Export, error) {
+	if glob == "" {
+		glob = "*"
+	}
+	ee := []Export{}
+	in := &cfn.ListExportsInput{}
+	for {
+		o, err := h.CFNcli.ListExports(context.Background(), in)
+		if err != nil {
+			return ee, fmt.Errorf("cant list exports: %w", err)
+		}
+		for _, e := range o.Exports {
+			if m, _ := filepath.Match(glob, str(e.Name)); !m {
+				continue
+			}
+			ee = append(ee, Export{Name: str(e.Name), Value: str(e.Value), Stack: stackName(str(e.ExportingStackId))})
+		}
+		if o.NextToken == nil {
+			break
+		}
+		in.NextToken = o.NextToken
+	}
+	sort.Slice(ee, func(i, j int) bool { return ee[i].Name < ee[j].Name })
+	return ee, nil
+}
+
+// Importers returns the names of the stacks which import the export.
+func (h Handle) Importers(export string) ([]string, error) {
+	ss := []string{}
+	in := &cfn.ListImportsInput{ExportName: aws.String(export)}
+	for {
+		o, err := h.CFNcli.ListImports(context.Background(), in)
+		if err != nil {
+			if strings.Contains(err.Error(), "is not imported by any stack") {
+				return ss, nil
+			}
+			return ss, fmt.Errorf("cant list imports of '%s': %w", export, err)
+		}
+		ss = append(ss, o.Imports...)
+		if o.NextToken == nil {
+			break
+		}
+		in.NextToken = o.NextToken
+	}
+	sort.Strings(ss)
+	return ss, nil
+}
+
+// Dependencies returns the imports of the exports of stacks matching glob.
+// Only the matching stacks' own exports, from their outputs, are looked up,
+// so a glob which is a stack name costs a call per export of the stack.
+func (h Handle) Dependencies(glob string) ([]Dependency, error) {
+	if glob == "" {
+		glob = "*"
+	}
+	in := &cfn.DescribeStacksInput{}
+	if !strings.ContainsAny(glob, `*?[\`) {
+		in.StackName = aws.String(glob)
+	}
+	ee := []Export{}
+	for {
+		o, err := h.CFNcli.DescribeStacks(context.Background(), in)
+		if err != nil {
+			return nil, fmt.Errorf("cant describe stacks: %w", err)
+		}
+		for _, s := range o.Stacks {
+			if m, _ := filepath.Match(glob, str(s.StackName)); !m {
+				continue
+			}
+			for _, out := range s.Outputs {
+				if out.ExportName != nil {
+					ee = append(ee, Export{Name: str(out.ExportName), Value: str(out.OutputValue), Stack: str(s.StackName)})
+				}
+			}
+		}
+		if o.NextToken == nil {
+			break
+		}
+		in.NextToken = o.NextToken
+	}
+	sort.Slice(ee, func(i, j int) bool { return ee[i].Name < ee[j].Name })
+
+	dd := []Dependency{}
+	for _, e := range ee {
+		ss, err := h.Importers(e.Name)
+		if err != nil {
+			return dd, err
+		}
+		for _, s := range ss {
+			dd = append(dd, Dependency{Stack: s, Export: e.Name, Exporter: e.Stack})
+		}
+	}
+	return dd, nil
+}
+
+// stackName returns the name from a stack id, which is an arn like
+// arn:aws:cloudformation:region:account:stack/name/uuid.
+func stackName(id string) string {
+	if _, rest, ok := strings.Cut(id, ":stack/"); ok {
+		name, _, _ := strings.Cut(rest, "/")
+		return name
+	}
+	return id
+}
@@ -0,0 +1,189 @@
+package sfm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IncludeKey is the directive which pulls a local fragment into a template.
+// At the top level of a template the fragment is a template-like document
+// whose sections are merged into the parent's sections, inside a section
+// (Resources, Outputs...) the fragment is a map of entries for that section.
+const IncludeKey = "Fn::sfm::Include"
+
+// includeSections are the template sections which are maps of named entries
+// and can have fragments included into them.
+var includeSections = []string{"Metadata", "Parameters", "Rules", "Mappings", "Conditions", "Resources", "Outputs"}
+
+// ResolveIncludes replaces include directives in the template with the
+// content of the fragments they name. Relative paths are resolved from the
+// directory of the including file; name is the path of the template, or
+// empty if it didn't come from a local file. Defining a key twice is an
+// error.
+func (d *Doc) ResolveIncludes(name string) error {
+	dir := "."
+	inc := includer{}
+	if name != "" {
+		dir = filepath.Dir(name)
+		if abs, err := filepath.Abs(name); err == nil {
+			inc.stack = append(inc.stack, abs)
+		}
+	} else {
+		name = "stdin"
+	}
+	return inc.template(d.Root, dir, name)
+}
+
+type includer struct {
+	stack []string // files currently being included, to catch cycles
+}
+
+// template expands the directives in a template-like map.
+func (inc *includer) template(root *Node, dir, name string) error {
+	for _, k := range root.Keys {
+		v := root.Map[k]
+		if contains(includeSections, k) && v.Kind == MapNode {
+			if err := inc.section(v, dir, name); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		}
+	}
+
+	paths, err := includePaths(root.Get(IncludeKey))
+	if err != nil {
+		return fmt.Errorf("%s line %d: %w", name, root.Get(IncludeKey).Line, err)
+	}
+	root.Delete(IncludeKey)
+	for _, p := range paths {
+		frag, fn, err := inc.load(dir, p)
+		if err != nil {
+			return err
+		}
+		err = inc.template(frag, filepath.Dir(fn), fn)
+		inc.stack = inc.stack[:len(inc.stack)-1]
+		if err != nil {
+			return err
+		}
+		for _, k := range frag.Keys {
+			v := frag.Map[k]
+			if !contains(includeSections, k) || v.Kind != MapNode {
+				return fmt.Errorf("%s: only the %s sections can be included, got '%s'", fn, strings.Join(includeSections, ", "), k)
+			}
+			sec := root.Get(k)
+			if sec == nil {
+				root.Set(k, v)
+				continue
+			}
+			for _, ek := range v.Keys {
+				if sec.Get(ek) != nil {
+					return fmt.Errorf("%s: '%s' from %s is already defined", k, ek, fn)
+				}
+				sec.Set(ek, v.Map[ek])
+			}
+		}
+	}
+	return nil
+}
+
+// section expands the directives in a section's map in place, so included
+// entries take the position of the directive.
+func (inc *includer) section(m *Node, dir, name string) error {
+	if m.Get(IncludeKey) == nil {
+		return nil
+	}
+	keys := m.Keys
+	entries := m.Map
+	m.Keys, m.Map = nil, map[string]*Node{}
+	owner := map[string]string{}
+	for _, k := range keys {
+		v := entries[k]
+		if k != IncludeKey {
+			if prev, ok := owner[k]; ok {
+				return fmt.Errorf("'%s' in %s collides with '%s' from %s", k, name, k, prev)
+			}
+			owner[k] = name
+			m.Set(k, v)
+			continue
+		}
+		paths, err := includePaths(v)
+		if err != nil {
+			return fmt.Errorf("%s line %d: %w", name, v.Line, err)
+		}
+		for _, p := range paths {
+			frag, fn, err := inc.load(dir, p)
+			if err != nil {
+				return err
+			}
+			err = inc.section(frag, filepath.Dir(fn), fn)
+			inc.stack = inc.stack[:len(inc.stack)-1]
+			if err != nil {
+				return err
+			}
+			for _, fk := range frag.Keys {
+				if prev, ok := owner[fk]; ok {
+					return fmt.Errorf("'%s' in %s collides with '%s' from %s", fk, fn, fk, prev)
+				}
+				owner[fk] = fn
+				m.Set(fk, frag.Map[fk])
+			}
+		}
+	}
+	return nil
+}
+
+// load reads the fragment at p and pushes it onto the include stack, the
+// caller pops it once the fragment has been expanded.
+func (inc *includer) load(dir, p string) (*Node, string, error) {
+	fn := filepath.Clean(p)
+	if !filepath.IsAbs(fn) {
+		fn = filepath.Join(dir, fn)
+	}
+	if abs, err := filepath.Abs(fn); err == nil {
+		fn = abs
+	}
+	if contains(inc.stack, fn) {
+		return nil, "", fmt.Errorf("include cycle: %s -> %s", strings.Join(inc.stack, " -> "), fn)
+	}
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, "", fmt.Errorf("cant read include: %w", err)
+	}
+	frag, err := ParseTemplate(b)
+	if err != nil {
+		return nil, "", fmt.Errorf("cant parse include %s: %w", fn, err)
+	}
+	inc.stack = append(inc.stack, fn)
+	return frag.Root, fn, nil
+}
+
+// includePaths returns the path or list of paths given to a directive.
+func includePaths(n *Node) ([]string, error) {
+	if n == nil {
+		return nil, nil
+	}
+	switch n.Kind {
+	case ScalarNode:
+		return []string{n.Value}, nil
+	case ListNode:
+		pp := []string{}
+		for _, el := range n.List {
+			if el.Kind != ScalarNode {
+				return nil, fmt.Errorf("%s expects a path or a list of paths", IncludeKey)
+			}
+			pp = append(pp, el.Value)
+		}
+		return pp, nil
+	}
+	return nil, fmt.Errorf("%s expects a path or a list of paths", IncludeKey)
+}
+
+func contains(ss []string, s string) bool {
+	for _, el := range ss {
+		if el == s {
+			return true
+		}
+	}
+	return false
+}
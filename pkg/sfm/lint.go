@@ -0,0 +1,372 @@
+package sfm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Finding levels.
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+)
+
+// Finding is a problem Lint found in a template.
+type Finding struct {
+	Rule    string
+	Level   string
+	Message string
+	Path    string // slash separated path to the offending node
+	Line    int
+	Column  int
+}
+
+// LintRules describes the rules Lint checks.
+var LintRules = map[string]string{
+	"undefined-ref":       "Ref or Fn::Sub refers to a parameter or resource which is not defined",
+	"undefined-getatt":    "Fn::GetAtt refers to a resource which is not defined",
+	"undefined-mapping":   "Fn::FindInMap refers to a mapping which is not defined",
+	"undefined-condition": "a condition is referenced but not defined",
+	"undefined-dependson": "DependsOn names a resource which is not defined",
+	"unused-parameter":    "a parameter is not referenced",
+	"unused-mapping":      "a mapping is not referenced",
+	"unused-condition":    "a condition is not referenced",
+	"duplicate-export":    "more than one output exports the same name",
+	"dependency-cycle":    "resources depend on each other through DependsOn, Ref, Fn::GetAtt or Fn::Sub",
+	"quota":               "the template exceeds a cloudformation quota",
+	"invalid-section":     "a template section has the wrong shape",
+
+	// LintSpec
+	"unknown-resource-type": "a resource type is not in the resource specification",
+	"unknown-property":      "a property is not in the resource specification",
+	"missing-property":      "a required property is missing",
+	"property-type":         "a property value has the wrong type",
+}
+
+// template quotas, see https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/cloudformation-limits.html
+const (
+	maxResources  = 500
+	maxParameters = 200
+	maxOutputs    = 200
+)
+
+// subVar matches the variables in a Fn::Sub string, ${!Literal} is skipped.
+var subVar = regexp.MustCompile(`\$\{([^!}][^}]*)\}`)
+
+// Lint runs offline structural checks against the template and returns the
+// findings ordered by position.
+func Lint(d *Doc) []Finding {
+	l := linter{
+		d:          d,
+		params:     sectionMap(d, "Parameters"),
+		mappings:   sectionMap(d, "Mappings"),
+		conditions: sectionMap(d, "Conditions"),
+		resources:  sectionMap(d, "Resources"),
+		outputs:    sectionMap(d, "Outputs"),
+		used:       map[string]bool{},
+		deps:       map[string][]string{},
+	}
+	// with a transform, refs may name resources or params the macro creates
+	l.refLevel = LevelError
+	if d.Section("Transform") != nil {
+		l.refLevel = LevelWarning
+	}
+
+	for _, name := range []string{"Parameters", "Mappings", "Conditions", "Resources", "Outputs"} {
+		if n := d.Section(name); n != nil && n.Kind != MapNode {
+			l.add("invalid-section", LevelError, n, name, "%s is not a map", name)
+		}
+	}
+
+	l.quotas()
+	for _, sec := range []string{"Rules", "Conditions", "Resources", "Outputs"} {
+		l.refs(sec)
+	}
+	l.unused()
+	l.exports()
+	l.cycles()
+
+	sort.SliceStable(l.ff, func(i, j int) bool {
+		if l.ff[i].Line != l.ff[j].Line {
+			return l.ff[i].Line < l.ff[j].Line
+		}
+		return l.ff[i].Column < l.ff[j].Column
+	})
+	return l.ff
+}
+
+type linter struct {
+	d  *Doc
+	ff []Finding
+
+	params     *Node
+	mappings   *Node
+	conditions *Node
+	resources  *Node
+	outputs    *Node
+
+	refLevel string
+	used     map[string]bool     // "Parameters/Name", "Mappings/Name", "Conditions/Name"
+	deps     map[string][]string // resource to the resources it depends on
+}
+
+func sectionMap(d *Doc, name string) *Node {
+	if n := d.Section(name); n != nil && n.Kind == MapNode {
+		return n
+	}
+	return NewMap()
+}
+
+func (l *linter) add(rule, level string, n *Node, path string, format string, a ...interface{}) {
+	f := Finding{Rule: rule, Level: level, Message: fmt.Sprintf(format, a...), Path: path}
+	if n != nil {
+		f.Line, f.Column = n.Line, n.Column
+	}
+	l.ff = append(l.ff, f)
+}
+
+func (l *linter) quotas() {
+	for _, q := range []struct {
+		name string
+		n    *Node
+		max  int
+	}{
+		{"Resources", l.resources, maxResources},
+		{"Parameters", l.params, maxParameters},
+		{"Outputs", l.outputs, maxOutputs},
+	} {
+		if len(q.n.Keys) > q.max {
+			l.add("quota", LevelError, l.d.Section(q.name), q.name, "%d %s exceeds the maximum of %d", len(q.n.Keys), strings.ToLower(q.name), q.max)
+		}
+	}
+}
+
+// refs checks the references made from a section, records which parameters,
+// mappings and conditions are used, and which resources depend on others.
+func (l *linter) refs(sec string) {
+	root := l.d.Section(sec)
+	if root == nil || root.Kind != MapNode {
+		return
+	}
+	for _, name := range root.Keys {
+		entry := root.Map[name]
+		base := sec + "/" + name
+		from := ""
+		if sec == "Resources" {
+			from = name
+		}
+
+		// resource and output level attributes
+		if sec == "Resources" || sec == "Outputs" {
+			if c := entry.Get("Condition"); c != nil && c.Kind == ScalarNode {
+				l.condition(c, base+"/Condition", c.Value)
+			}
+		}
+		if sec == "Resources" {
+			if dep := entry.Get("DependsOn"); dep != nil {
+				dd := []*Node{dep}
+				if dep.Kind == ListNode {
+					dd = dep.List
+				}
+				for _, dn := range dd {
+					if dn.Kind != ScalarNode {
+						continue
+					}
+					if l.resources.Get(dn.Value) == nil {
+						l.add("undefined-dependson", LevelError, dn, base+"/DependsOn", "DependsOn '%s' is not a resource", dn.Value)
+						continue
+					}
+					l.depend(name, dn.Value)
+				}
+			}
+		}
+
+		entry.Walk(func(path []string, n *Node) bool {
+			if n.Kind != FuncNode {
+				return true
+			}
+			p := base
+			if len(path) > 0 {
+				p += "/" + strings.Join(path, "/")
+			}
+			l.fn(n, p, from)
+			return true
+		})
+	}
+}
+
+// fn checks a single intrinsic function.
+func (l *linter) fn(n *Node, path, from string) {
+	arg := n.longArg()
+	switch n.Func {
+	case "Ref":
+		if arg.Kind == ScalarNode {
+			l.ref(arg, path, arg.Value, from)
+		}
+	case "Fn::GetAtt":
+		if arg.Kind == ListNode && len(arg.List) > 0 && arg.List[0].Kind == ScalarNode {
+			res := arg.List[0].Value
+			if l.resources.Get(res) == nil {
+				l.add("undefined-getatt", l.refLevel, n, path, "Fn::GetAtt refers to undefined resource '%s'", res)
+				return
+			}
+			l.depend(from, res)
+		}
+	case "Fn::Sub":
+		s := arg
+		vars := NewMap()
+		if arg.Kind == ListNode && len(arg.List) > 0 {
+			s = arg.List[0]
+			if len(arg.List) > 1 && arg.List[1].Kind == MapNode {
+				vars = arg.List[1]
+			}
+		}
+		if s.Kind != ScalarNode {
+			return
+		}
+		for _, m := range subVar.FindAllStringSubmatch(s.Value, -1) {
+			v := strings.TrimSpace(m[1])
+			if vars.Get(v) != nil {
+				continue
+			}
+			if res, _, ok := strings.Cut(v, "."); ok && !strings.HasPrefix(v, "AWS::") {
+				if l.resources.Get(res) == nil {
+					l.add("undefined-getatt", l.refLevel, n, path, "Fn::Sub refers to attribute of undefined resource '%s'", res)
+					continue
+				}
+				l.depend(from, res)
+				continue
+			}
+			l.ref(n, path, v, from)
+		}
+	case "Fn::FindInMap":
+		if arg.Kind == ListNode && len(arg.List) > 0 && arg.List[0].Kind == ScalarNode {
+			m := arg.List[0].Value
+			l.used["Mappings/"+m] = true
+			if l.mappings.Get(m) == nil {
+				l.add("undefined-mapping", LevelError, n, path, "Fn::FindInMap refers to undefined mapping '%s'", m)
+			}
+		}
+	case "Fn::If":
+		if arg.Kind == ListNode && len(arg.List) > 0 && arg.List[0].Kind == ScalarNode {
+			l.condition(arg.List[0], path, arg.List[0].Value)
+		}
+	case "Condition":
+		if arg.Kind == ScalarNode {
+			l.condition(arg, path, arg.Value)
+		}
+	}
+}
+
+func (l *linter) ref(n *Node, path, name, from string) {
+	if strings.HasPrefix(name, "AWS::") {
+		return
+	}
+	if l.params.Get(name) != nil {
+		l.used["Parameters/"+name] = true
+		return
+	}
+	if l.resources.Get(name) != nil {
+		l.depend(from, name)
+		return
+	}
+	l.add("undefined-ref", l.refLevel, n, path, "'%s' is not a parameter or resource", name)
+}
+
+func (l *linter) condition(n *Node, path, name string) {
+	l.used["Conditions/"+name] = true
+	if l.conditions.Get(name) == nil {
+		l.add("undefined-condition", LevelError, n, path, "condition '%s' is not defined", name)
+	}
+}
+
+// depend records that from depends on to. A dependency is only recorded
+// once, however many ways it's made, so a cycle is only reported once.
+func (l *linter) depend(from, to string) {
+	if from == "" || contains(l.deps[from], to) {
+		return
+	}
+	l.deps[from] = append(l.deps[from], to)
+}
+
+func (l *linter) unused() {
+	for _, u := range []struct {
+		sec  string
+		n    *Node
+		rule string
+	}{
+		{"Parameters", l.params, "unused-parameter"},
+		{"Mappings", l.mappings, "unused-mapping"},
+		{"Conditions", l.conditions, "unused-condition"},
+	} {
+		for _, k := range u.n.Keys {
+			if !l.used[u.sec+"/"+k] {
+				l.add(u.rule, LevelWarning, u.n.Map[k], u.sec+"/"+k, "%s '%s' is not used", strings.ToLower(strings.TrimSuffix(u.sec, "s")), k)
+			}
+		}
+	}
+}
+
+func (l *linter) exports() {
+	seen := map[string]string{}
+	for _, k := range l.outputs.Keys {
+		name := l.outputs.Map[k].Get("Export").Get("Name")
+		if name == nil {
+			continue
+		}
+		key := name.Value
+		if name.Kind != ScalarNode {
+			// compare intrinsics structurally
+			b, err := name.JSON()
+			if err != nil {
+				continue
+			}
+			key = string(b)
+		}
+		if prev, ok := seen[key]; ok {
+			l.add("duplicate-export", LevelError, name, "Outputs/"+k+"/Export/Name", "output '%s' exports the same name as output '%s'", k, prev)
+			continue
+		}
+		seen[key] = k
+	}
+}
+
+// cycles reports each dependency cycle between resources once.
+func (l *linter) cycles() {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	stack := []string{}
+	var visit func(string)
+	visit = func(r string) {
+		state[r] = visiting
+		stack = append(stack, r)
+		deps := append([]string{}, l.deps[r]...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				i := len(stack) - 1
+				for stack[i] != dep {
+					i--
+				}
+				cycle := append(append([]string{}, stack[i:]...), dep)
+				l.add("dependency-cycle", LevelError, l.resources.Get(dep), "Resources/"+dep, "circular dependency: %s", strings.Join(cycle, " -> "))
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[r] = done
+	}
+	for _, r := range l.resources.Keys {
+		if state[r] == unvisited {
+			visit(r)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package sfm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfn "github.com/aws/aws-sdk-go-v2/service/cloudformation"
+)
+
+// AllowAllPolicy is a stack policy which allows every update. A stack policy
+// can't be removed once set, so clearing one means setting this.
+const AllowAllPolicy = `{"Statement":[{"Effect":"Allow","Action":"Update:*","Principal":"*","Resource":"*"}]}`
+
+// GetPolicy returns the stack policy of the named stack, or an empty string
+// if the stack has no policy.
+func (h Handle) GetPolicy(name string) (string, error) {
+	o, err := h.CFNcli.GetStackPolicy(context.Background(), &cfn.GetStackPolicyInput{StackName: aws.String(name)})
+	if err != nil {
+		return "", fmt.Errorf("cant get stack policy: %w", err)
+	}
+	return str(o.StackPolicyBody), nil
+}
+
+// SetPolicy sets the stack policy of the named stack.
+func (h Handle) SetPolicy(name, policy string) error {
+	_, err := h.CFNcli.SetStackPolicy(context.Background(), &cfn.SetStackPolicyInput{
+		StackName:       aws.String(name),
+		StackPolicyBody: aws.String(policy),
+	})
+	if err != nil {
+		return fmt.Errorf("cant set stack policy: %w", err)
+	}
+	return nil
+}
+
+// ClearPolicy replaces the stack policy of the named stack with
+// AllowAllPolicy.
+func (h Handle) ClearPolicy(name string) error {
+	return h.SetPolicy(name, AllowAllPolicy)
+}
@@ -0,0 +1,51 @@
+package sfm
+
+// Preview rewrites the template for a preview copy of a stack. Every export
+// name gets "-" and the suffix appended, so the copy doesn't clash with the
+// original, and imports of names which have been exported with the suffix,
+// as reported by exported, import the suffixed name instead. vars are used
+// to work out the names, see Eval; an export name which can't be worked out
+// is wrapped in a Fn::Join. Preview returns the names of the rewritten
+// imports.
+func (d *Doc) Preview(suffix string, vars map[string]string, exported func(string) bool) []string {
+	if oo := d.Section("Outputs"); oo != nil && oo.Kind == MapNode {
+		for _, k := range oo.Keys {
+			if name := oo.Map[k].Get("Export").Get("Name"); name != nil {
+				name.suffix(suffix, vars)
+			}
+		}
+	}
+
+	rewritten := []string{}
+	d.Root.Walk(func(_ []string, n *Node) bool {
+		if n.Kind != FuncNode || n.Func != "Fn::ImportValue" {
+			return true
+		}
+		name, ok := n.longArg().Eval(vars)
+		if ok && exported(name+"-"+suffix) {
+			arg := NewScalar(name + "-" + suffix)
+			arg.keyStyle = n.Arg.keyStyle
+			n.Arg = arg
+			rewritten = append(rewritten, name)
+		}
+		return false
+	})
+	return rewritten
+}
+
+// suffix replaces n, in place, with n's value and "-" and the suffix.
+func (n *Node) suffix(suffix string, vars map[string]string) {
+	if v, ok := n.Eval(vars); ok {
+		*n = Node{Kind: ScalarNode, Value: v + "-" + suffix, Tag: "!!str", Line: n.Line, Column: n.Column,
+			keyStyle: n.keyStyle, keyComments: n.keyComments}
+		return
+	}
+	inner := n.Clone()
+	inner.keyStyle, inner.keyComments = 0, [3]string{}
+	*n = Node{Kind: FuncNode, Func: "Fn::Join", Line: n.Line, Column: n.Column,
+		Arg: &Node{Kind: ListNode, List: []*Node{
+			NewScalar(""),
+			{Kind: ListNode, List: []*Node{inner, NewScalar("-" + suffix)}},
+		}},
+		keyStyle: n.keyStyle, keyComments: n.keyComments}
+}
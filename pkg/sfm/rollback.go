@@ -0,0 +1,73 @@
+package sfm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfn "github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/google/uuid"
+)
+
+// ContinueRollback continues rolling back a stack in UPDATE_ROLLBACK_FAILED
+// and returns a ClientRequestToken and an error. Resources which can't be
+// rolled back can be skipped, they are left as they are and marked
+// UPDATE_COMPLETE. The stack's service role is used if role is empty.
+func (h Handle) ContinueRollback(name string, skip []string, role string) (string, error) {
+	token := uuid.NewString()
+	i := &cfn.ContinueUpdateRollbackInput{
+		StackName:          aws.String(name),
+		ResourcesToSkip:    skip,
+		ClientRequestToken: &token,
+	}
+	if role != "" {
+		i.RoleARN = aws.String(role)
+	}
+	if _, err := h.CFNcli.ContinueUpdateRollback(context.Background(), i); err != nil {
+		return token, fmt.Errorf("cant continue update rollback: %w", err)
+	}
+	return token, nil
+}
+
+// Failures returns the latest failure event of each resource which failed
+// since the stack last reported the status since, e.g. UPDATE_ROLLBACK_IN_PROGRESS
+// for the resources blocking a rollback. Events are returned oldest first.
+func (s Stack) Failures(since string) ([]Event, error) {
+	if s.Handle.CFNcli == nil {
+		return nil, errors.New("Stack has no Handle")
+	}
+
+	events := []Event{}
+	seen := map[string]bool{}
+	pg := cfn.NewDescribeStackEventsPaginator(s.Handle.CFNcli, &cfn.DescribeStackEventsInput{StackName: aws.String(s.Name)})
+	for pg.HasMorePages() {
+		o, err := pg.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("cant describe stack events: %w", err)
+		}
+		for _, e := range o.StackEvents {
+			ev := Event{
+				ID:        str(e.EventId),
+				Resource:  str(e.LogicalResourceId),
+				Status:    string(e.ResourceStatus),
+				Reason:    str(e.ResourceStatusReason),
+				Timestamp: aws.ToTime(e.Timestamp),
+				Token:     str(e.ClientRequestToken),
+			}
+			if str(e.ResourceType) == "AWS::CloudFormation::Stack" && str(e.PhysicalResourceId) == str(e.StackId) {
+				if ev.Status == since {
+					return events, nil
+				}
+				continue
+			}
+			if !strings.HasSuffix(ev.Status, "_FAILED") || seen[ev.Resource] {
+				continue
+			}
+			seen[ev.Resource] = true
+			events = append([]Event{ev}, events...)
+		}
+	}
+	return events, nil
+}
@@ -12,7 +12,6 @@ import (
 	cfn "github.com/aws/aws-sdk-go-v2/service/cloudformation"
 	cfntyp "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
 	"github.com/google/uuid"
-	"gopkg.in/yaml.v2"
 )
 
 var defaultCaps = []cfntyp.Capability{cfntyp.CapabilityCapabilityNamedIam, cfntyp.CapabilityCapabilityAutoExpand}
@@ -28,6 +27,9 @@ type Handle struct {
 type Stack struct {
 	NoRollback bool
 	TermProc   bool
+	OnFailure  string // DELETE, DO_NOTHING or ROLLBACK; create only
+	Timeout    int    // minutes; create only
+	RoleARN    string
 
 	Name   string
 	Short  string // ok, prog, err
@@ -35,11 +37,19 @@ type Stack struct {
 	Reason string
 	Desc   string
 
-	Caps    []string
-	Topics  []string
-	Params  map[string]string
-	Outputs map[string]string
-	Tags    map[string]string
+	Caps          []string // added to the capabilities the template requires
+	Topics        []string
+	ResourceTypes []string // restricts the resource types the stack can use
+	Params        map[string]string
+	Outputs       map[string]string
+	Tags          map[string]string
+
+	RollbackAlarms  []string // cloudwatch alarm arns to monitor
+	RollbackMonitor int      // minutes to monitor the alarms after the operation
+
+	Policy       string `json:"-" yaml:"-"` // stack policy set by Make
+	KeepParams   bool   `json:"-" yaml:"-"` // on update, parameters not in Params keep their values
+	UpdatePolicy string `json:"-" yaml:"-"` // overrides Policy during an update
 
 	Created time.Time
 	Updated time.Time
@@ -47,6 +57,7 @@ type Stack struct {
 	Handle       Handle `json:"-" yaml:"-"`
 	Template     Template
 	TemplateBody string `json:"-" yaml:"-"`
+	TemplateURL  string `json:"-" yaml:"-"` // read instead of TemplateBody when set, for bodies over 51,200 bytes
 }
 
 // Template contains the content of the cloudformation template and probably
@@ -144,19 +155,42 @@ func (h Handle) Make(s Stack) (string, error) {
 	if s.Name == "" {
 		return "", errors.New("missing stack name")
 	}
-	if len(s.TemplateBody) < 1 {
+	if len(s.TemplateBody) < 1 && s.TemplateURL == "" {
 		return "", errors.New("stack has empty template")
 	}
+	if s.NoRollback && s.OnFailure != "" {
+		return "", errors.New("NoRollback and OnFailure are mutually exclusive")
+	}
 	token := uuid.NewString()
 	i := &cfn.CreateStackInput{
-		StackName:          aws.String(s.Name),
-		DisableRollback:    aws.Bool(s.NoRollback),
-		Capabilities:       defaultCaps,
-		Parameters:         s.paramsToAWS(),
-		Tags:               s.tagsToAWS(),
-		TemplateBody:       aws.String(s.TemplateBody),
-		NotificationARNs:   s.Topics,
-		ClientRequestToken: &token,
+		StackName:                   aws.String(s.Name),
+		Capabilities:                h.caps(s),
+		Parameters:                  s.paramsToAWS(),
+		Tags:                        s.tagsToAWS(),
+		NotificationARNs:            s.Topics,
+		ClientRequestToken:          &token,
+		EnableTerminationProtection: aws.Bool(s.TermProc),
+		ResourceTypes:               s.ResourceTypes,
+		RollbackConfiguration:       s.rollbackToAWS(),
+	}
+	if s.TemplateURL != "" {
+		i.TemplateURL = aws.String(s.TemplateURL)
+	} else {
+		i.TemplateBody = aws.String(s.TemplateBody)
+	}
+	if s.OnFailure != "" {
+		i.OnFailure = cfntyp.OnFailure(s.OnFailure)
+	} else {
+		i.DisableRollback = aws.Bool(s.NoRollback)
+	}
+	if s.Timeout > 0 {
+		i.TimeoutInMinutes = aws.Int32(int32(s.Timeout))
+	}
+	if s.RoleARN != "" {
+		i.RoleARN = aws.String(s.RoleARN)
+	}
+	if s.Policy != "" {
+		i.StackPolicyBody = aws.String(s.Policy)
 	}
 
 	_, err := h.CFNcli.CreateStack(context.Background(), i)
@@ -173,11 +207,18 @@ func (h Handle) Make(s Stack) (string, error) {
 
 // Delete deletes a stack and returns a ClientRequestToken and an error.
 func (h Handle) Delete(name string) (string, error) {
+	return h.DeleteRetain(name, nil)
+}
+
+// DeleteRetain deletes a stack in DELETE_FAILED, leaving the resources named
+// by logical id in place, and returns a ClientRequestToken and an error.
+func (h Handle) DeleteRetain(name string, retain []string) (string, error) {
 	token := uuid.NewString()
 	_, err := h.CFNcli.DeleteStack(
 		context.Background(),
 		&cfn.DeleteStackInput{
 			StackName:          aws.String(name),
+			RetainResources:    retain,
 			ClientRequestToken: &token,
 		},
 	)
@@ -187,16 +228,90 @@ func (h Handle) Delete(name string) (string, error) {
 	return token, err
 }
 
+// Protect enables or disables termination protection on the named stack.
+func (h Handle) Protect(name string, on bool) error {
+	_, err := h.CFNcli.UpdateTerminationProtection(
+		context.Background(),
+		&cfn.UpdateTerminationProtectionInput{
+			StackName:                   aws.String(name),
+			EnableTerminationProtection: aws.Bool(on),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("cant update termination protection: %w", err)
+	}
+	return nil
+}
+
+// GetTemplate returns the template body of the named stack as it was
+// submitted, before any transforms.
+func (h Handle) GetTemplate(name string) (string, error) {
+	o, err := h.CFNcli.GetTemplate(context.Background(), &cfn.GetTemplateInput{
+		StackName:     aws.String(name),
+		TemplateStage: cfntyp.TemplateStageOriginal,
+	})
+	if err != nil {
+		return "", fmt.Errorf("cant get template: %w", err)
+	}
+	return str(o.TemplateBody), nil
+}
+
+// updateParams returns the stack's parameters for an update of an existing
+// stack; parameters the template declares which aren't in s.Params keep
+// their current values.
+func (h Handle) updateParams(s Stack) []cfntyp.Parameter {
+	pp := s.paramsToAWS()
+	cur, err := h.Get(s.Name)
+	if err != nil {
+		return pp
+	}
+	for k := range cur.Params {
+		if _, ok := s.Params[k]; ok {
+			continue
+		}
+		if _, ok := s.Template.Parameters[k]; ok {
+			pp = append(pp, cfntyp.Parameter{ParameterKey: aws.String(k), UsePreviousValue: aws.Bool(true)})
+		}
+	}
+	return pp
+}
+
 func (h Handle) update(s Stack) (string, error) {
 	token := uuid.NewString()
 	i := &cfn.UpdateStackInput{
-		StackName:          aws.String(s.Name),
-		Capabilities:       defaultCaps,
-		Parameters:         s.paramsToAWS(),
-		Tags:               s.tagsToAWS(),
-		TemplateBody:       aws.String(s.TemplateBody),
-		NotificationARNs:   s.Topics,
-		ClientRequestToken: &token,
+		StackName:             aws.String(s.Name),
+		Capabilities:          h.caps(s),
+		Parameters:            s.paramsToAWS(),
+		Tags:                  s.tagsToAWS(),
+		NotificationARNs:      s.Topics,
+		ClientRequestToken:    &token,
+		ResourceTypes:         s.ResourceTypes,
+		RollbackConfiguration: s.rollbackToAWS(),
+	}
+	if s.TemplateURL != "" {
+		i.TemplateURL = aws.String(s.TemplateURL)
+	} else {
+		i.TemplateBody = aws.String(s.TemplateBody)
+	}
+	if s.KeepParams {
+		i.Parameters = h.updateParams(s)
+	}
+	if s.RoleARN != "" {
+		i.RoleARN = aws.String(s.RoleARN)
+	}
+	if s.Policy != "" {
+		i.StackPolicyBody = aws.String(s.Policy)
+	}
+	if s.UpdatePolicy != "" {
+		i.StackPolicyDuringUpdateBody = aws.String(s.UpdatePolicy)
+	}
+
+	// termination protection isn't part of an update, it is only ever
+	// switched on here
+	if s.TermProc {
+		if err := h.Protect(s.Name, true); err != nil {
+			return token, err
+		}
 	}
 
 	_, err := h.CFNcli.UpdateStack(context.Background(), i)
@@ -232,13 +347,45 @@ func (s Stack) Resources() (map[string]map[string]string, error) {
 		mm[id]["status"] = string(r.ResourceStatus)
 		mm[id]["type"] = *r.ResourceType
 		mm[id]["updated"] = fmt.Sprintf("%v", *r.Timestamp)
-		mm[id]["pid"] = *r.PhysicalResourceId
+		mm[id]["pid"] = str(r.PhysicalResourceId)
 		mm[id]["reason"] = reason
 		mm[id]["stackid"] = *r.StackId
 	}
 	return mm, nil
 }
 
+// AllResources returns every resource of the stack, paging through them
+// where Resources stops at 100. The maps have the same keys as Resources',
+// except stackid.
+func (s Stack) AllResources() (map[string]map[string]string, error) {
+	if s.Handle.CFNcli == nil {
+		return nil, errors.New("Stack has no Handle")
+	}
+	mm := map[string]map[string]string{}
+	i := &cfn.ListStackResourcesInput{StackName: aws.String(s.Name)}
+	for {
+		o, err := s.Handle.CFNcli.ListStackResources(context.Background(), i)
+		if err != nil {
+			return nil, fmt.Errorf("cant list stack resources: %w", err)
+		}
+		for _, r := range o.StackResourceSummaries {
+			id := str(r.LogicalResourceId)
+			mm[id] = map[string]string{
+				"status":  string(r.ResourceStatus),
+				"type":    str(r.ResourceType),
+				"updated": fmt.Sprintf("%v", aws.ToTime(r.LastUpdatedTimestamp)),
+				"pid":     str(r.PhysicalResourceId),
+				"reason":  str(r.ResourceStatusReason),
+			}
+		}
+		if o.NextToken == nil {
+			break
+		}
+		i.NextToken = o.NextToken
+	}
+	return mm, nil
+}
+
 // Events returns stack events which were generated after the supplied EventId for the supplied request token.
 // If no EventId is supplied (an empty string) the most recent Event is returned.
 // If no ClientRequestToken is supplied (an empty string) events aren't filtered by request token.
@@ -341,6 +488,23 @@ func (s Stack) paramsToAWS() []cfntyp.Parameter {
 	return pp
 }
 
+func (s Stack) rollbackToAWS() *cfntyp.RollbackConfiguration {
+	if len(s.RollbackAlarms) < 1 && s.RollbackMonitor < 1 {
+		return nil
+	}
+	rc := &cfntyp.RollbackConfiguration{}
+	for _, arn := range s.RollbackAlarms {
+		rc.RollbackTriggers = append(rc.RollbackTriggers, cfntyp.RollbackTrigger{
+			Arn:  aws.String(arn),
+			Type: aws.String("AWS::CloudWatch::Alarm"),
+		})
+	}
+	if s.RollbackMonitor > 0 {
+		rc.MonitoringTimeInMinutes = aws.Int32(int32(s.RollbackMonitor))
+	}
+	return rc
+}
+
 func (s Stack) tagsToAWS() []cfntyp.Tag {
 	tags := []cfntyp.Tag{}
 	for k, v := range s.Tags {
@@ -349,10 +513,13 @@ func (s Stack) tagsToAWS() []cfntyp.Tag {
 	return tags
 }
 
+// NewTemplate parses a json or yaml template body into the Stack.
 func (s *Stack) NewTemplate(body []byte) error {
-	if err := yaml.Unmarshal(body, &s.Template); err != nil {
+	d, err := ParseTemplate(body)
+	if err != nil {
 		return fmt.Errorf("cant unmarshal template into stack: %v", err)
 	}
+	s.Template = d.Template()
 	s.TemplateBody = string(body)
 	return nil
 }
@@ -381,6 +548,21 @@ func NewFromAWS(cs cfntyp.Stack) Stack {
 		s.Updated = *cs.LastUpdatedTime
 	}
 
+	if cs.TimeoutInMinutes != nil {
+		s.Timeout = int(*cs.TimeoutInMinutes)
+	}
+
+	s.RoleARN = str(cs.RoleARN)
+
+	if rc := cs.RollbackConfiguration; rc != nil {
+		for _, t := range rc.RollbackTriggers {
+			s.RollbackAlarms = append(s.RollbackAlarms, str(t.Arn))
+		}
+		if rc.MonitoringTimeInMinutes != nil {
+			s.RollbackMonitor = int(*rc.MonitoringTimeInMinutes)
+		}
+	}
+
 	for _, c := range cs.Capabilities {
 		s.Caps = append(s.Caps, string(c))
 	}
@@ -0,0 +1,240 @@
+package sfm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Spec is the cloudformation resource specification, the json document AWS
+// publishes per region, e.g.
+// https://d1uauaxba7bl26.cloudfront.net/latest/gzip/CloudFormationResourceSpecification.json
+type Spec struct {
+	ResourceSpecificationVersion string
+	ResourceTypes                map[string]SpecType
+	PropertyTypes                map[string]SpecType
+}
+
+// SpecType describes a resource type or a property type.
+type SpecType struct {
+	Properties map[string]SpecProperty
+}
+
+// SpecProperty describes a single property of a SpecType.
+type SpecProperty struct {
+	Required          bool
+	PrimitiveType     string
+	Type              string // List, Map or the name of a property type
+	PrimitiveItemType string
+	ItemType          string
+}
+
+// LoadSpec decodes a resource specification, which may be gzipped.
+func LoadSpec(b []byte) (*Spec, error) {
+	if bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("cant read gzipped spec: %w", err)
+		}
+		if b, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("cant read gzipped spec: %w", err)
+		}
+	}
+	spec := &Spec{}
+	if err := json.Unmarshal(b, spec); err != nil {
+		return nil, fmt.Errorf("cant unmarshal spec: %w", err)
+	}
+	if len(spec.ResourceTypes) == 0 {
+		return nil, fmt.Errorf("spec has no resource types")
+	}
+	return spec, nil
+}
+
+// LintSpec validates the resources in the template against the resource
+// specification: types must exist, properties must be known, required
+// properties must be set, and literal values must have the right type.
+// Values which are intrinsic functions are not type checked.
+func LintSpec(d *Doc, spec *Spec) []Finding {
+	l := linter{d: d}
+	res := sectionMap(d, "Resources")
+	transform := d.Section("Transform") != nil
+	for _, name := range res.Keys {
+		r := res.Map[name]
+		base := "Resources/" + name
+		tn := r.Get("Type")
+		if tn == nil || tn.Kind != ScalarNode {
+			continue
+		}
+		typ := tn.Value
+		if strings.HasPrefix(typ, "Custom::") {
+			continue
+		}
+		rt, ok := spec.ResourceTypes[typ]
+		if !ok {
+			// macros and the registry can provide types the spec doesn't know
+			level := LevelError
+			if transform || !strings.HasPrefix(typ, "AWS::") {
+				level = LevelWarning
+			}
+			l.add("unknown-resource-type", level, tn, base+"/Type", "resource type '%s' is not in the specification%s", typ, suggest(typ, keys(spec.ResourceTypes)))
+			continue
+		}
+		props := r.Get("Properties")
+		if props == nil {
+			props = NewMap()
+		}
+		l.specProps(spec, typ, rt, props, base+"/Properties")
+	}
+	sort.SliceStable(l.ff, func(i, j int) bool { return l.ff[i].Line < l.ff[j].Line })
+	return l.ff
+}
+
+// specProps checks a map of properties against a resource or property type.
+func (l *linter) specProps(spec *Spec, resType string, st SpecType, props *Node, path string) {
+	if props.Kind == FuncNode {
+		return
+	}
+	if props.Kind != MapNode {
+		l.add("property-type", LevelError, props, path, "expected a map of properties")
+		return
+	}
+	for _, k := range props.Keys {
+		v := props.Map[k]
+		p, ok := st.Properties[k]
+		if !ok {
+			l.add("unknown-property", LevelError, v, path+"/"+k, "unknown property '%s'%s", k, suggest(k, keys(st.Properties)))
+			continue
+		}
+		l.specValue(spec, resType, p.PrimitiveType, p.Type, p.PrimitiveItemType, p.ItemType, v, path+"/"+k)
+	}
+	req := []string{}
+	for k, p := range st.Properties {
+		if p.Required && props.Get(k) == nil {
+			req = append(req, k)
+		}
+	}
+	sort.Strings(req)
+	for _, k := range req {
+		l.add("missing-property", LevelError, props, path, "required property '%s' is missing", k)
+	}
+}
+
+// specValue checks a single value against its primitive or complex type.
+func (l *linter) specValue(spec *Spec, resType, prim, typ, itemPrim, itemType string, v *Node, path string) {
+	if v.Kind == FuncNode {
+		return
+	}
+	if prim != "" {
+		if msg := checkPrimitive(prim, v); msg != "" {
+			l.add("property-type", LevelError, v, path, "%s", msg)
+		}
+		return
+	}
+	switch typ {
+	case "List":
+		if v.Kind != ListNode {
+			l.add("property-type", LevelError, v, path, "expected a list")
+			return
+		}
+		for i, el := range v.List {
+			l.specValue(spec, resType, itemPrim, itemType, "", "", el, fmt.Sprintf("%s/%d", path, i))
+		}
+	case "Map":
+		if v.Kind != MapNode {
+			l.add("property-type", LevelError, v, path, "expected a map")
+			return
+		}
+		for _, k := range v.Keys {
+			l.specValue(spec, resType, itemPrim, itemType, "", "", v.Map[k], path+"/"+k)
+		}
+	case "":
+	default:
+		pt, ok := spec.PropertyTypes[resType+"."+typ]
+		if !ok {
+			pt, ok = spec.PropertyTypes[typ] // e.g. Tag
+		}
+		if ok {
+			l.specProps(spec, resType, pt, v, path)
+		}
+	}
+}
+
+// checkPrimitive returns a message if the literal value v can't be the
+// primitive type prim.
+func checkPrimitive(prim string, v *Node) string {
+	if v.Kind != ScalarNode {
+		if prim == "Json" && v.Kind == MapNode {
+			return ""
+		}
+		return fmt.Sprintf("expected a %s value", strings.ToLower(prim))
+	}
+	switch prim {
+	case "Integer", "Long":
+		if _, err := strconv.ParseInt(v.Value, 10, 64); err != nil {
+			return fmt.Sprintf("'%s' is not an integer", v.Value)
+		}
+	case "Double":
+		if _, err := strconv.ParseFloat(v.Value, 64); err != nil {
+			return fmt.Sprintf("'%s' is not a number", v.Value)
+		}
+	case "Boolean":
+		if b := strings.ToLower(v.Value); b != "true" && b != "false" {
+			return fmt.Sprintf("'%s' is not a boolean", v.Value)
+		}
+	}
+	return ""
+}
+
+func keys[T any](m map[string]T) []string {
+	kk := make([]string, 0, len(m))
+	for k := range m {
+		kk = append(kk, k)
+	}
+	sort.Strings(kk)
+	return kk
+}
+
+// suggest returns a "did you mean" hint for the candidate closest to s.
+func suggest(s string, candidates []string) string {
+	best, dist := "", len(s)/3+1
+	for _, c := range candidates {
+		if d := levenshtein(strings.ToLower(s), strings.ToLower(c)); d < dist {
+			best, dist = c, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean '%s'?", best)
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
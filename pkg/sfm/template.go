@@ -0,0 +1,525 @@
+package sfm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NodeKind identifies the kind of value held by a Node.
+type NodeKind int
+
+// The kinds of Node.
+const (
+	ScalarNode NodeKind = iota
+	MapNode
+	ListNode
+	FuncNode
+)
+
+// Node is a value in a template. Maps keep the order of their keys and
+// intrinsic functions are FuncNodes, whether they were written in the long
+// form ({"Ref": "x"}) or the short form (!Ref x), so templates can be
+// inspected and then written back out the way they were read.
+type Node struct {
+	Kind NodeKind
+
+	Value string // scalar text as written in the source
+	Tag   string // scalar yaml tag, e.g. !!str, !!int, !!bool, or a tag which isn't a short form function, e.g. !Custom, on any node
+
+	Keys []string // map keys in order
+	Map  map[string]*Node
+
+	List []*Node
+
+	Func  string // intrinsic function name, e.g. Ref, Fn::GetAtt
+	Arg   *Node  // intrinsic function argument
+	Short bool   // intrinsic function was written in the short form
+
+	Line   int
+	Column int
+
+	style       yaml.Style
+	keyStyle    yaml.Style // style of this node's key in a map
+	comments    [3]string  // head, line and foot comments
+	keyComments [3]string  // comments attached to this node's key in a map
+}
+
+// Doc is a parsed cloudformation template.
+type Doc struct {
+	Root *Node
+	JSON bool // the template was written as json
+}
+
+// shortFuncs maps the short form yaml tags to their intrinsic function.
+var shortFuncs = map[string]string{
+	"!Ref":          "Ref",
+	"!Condition":    "Condition",
+	"!Base64":       "Fn::Base64",
+	"!Cidr":         "Fn::Cidr",
+	"!FindInMap":    "Fn::FindInMap",
+	"!GetAtt":       "Fn::GetAtt",
+	"!GetAZs":       "Fn::GetAZs",
+	"!ImportValue":  "Fn::ImportValue",
+	"!Join":         "Fn::Join",
+	"!Select":       "Fn::Select",
+	"!Split":        "Fn::Split",
+	"!Sub":          "Fn::Sub",
+	"!Transform":    "Fn::Transform",
+	"!And":          "Fn::And",
+	"!Equals":       "Fn::Equals",
+	"!If":           "Fn::If",
+	"!Not":          "Fn::Not",
+	"!Or":           "Fn::Or",
+	"!Length":       "Fn::Length",
+	"!ToJsonString": "Fn::ToJsonString",
+}
+
+// ParseTemplate parses a json or yaml template.
+func ParseTemplate(body []byte) (*Doc, error) {
+	var yn yaml.Node
+	if err := yaml.Unmarshal(body, &yn); err != nil {
+		return nil, fmt.Errorf("cant parse template: %w", err)
+	}
+	if len(yn.Content) == 0 {
+		return nil, errors.New("template is empty")
+	}
+	root, err := fromYAML(yn.Content[0])
+	if err != nil {
+		return nil, err
+	}
+	if root.Kind != MapNode {
+		return nil, errors.New("template is not a map")
+	}
+	root.comments[0] = joinComments(yn.HeadComment, root.comments[0])
+	return &Doc{Root: root, JSON: bytes.HasPrefix(bytes.TrimSpace(body), []byte("{"))}, nil
+}
+
+// Section returns a top level section of the template, or nil.
+func (d *Doc) Section(name string) *Node {
+	return d.Root.Get(name)
+}
+
+// Marshal encodes the template in the format it was parsed from.
+func (d *Doc) Marshal() ([]byte, error) {
+	if d.JSON {
+		return d.Root.JSON()
+	}
+	return d.Root.YAML()
+}
+
+// Template returns the template as the simpler Template struct.
+func (d *Doc) Template() Template {
+	t := Template{}
+	sec := func(name string) map[string]interface{} {
+		if m, ok := d.Section(name).Interface().(map[string]interface{}); ok {
+			return m
+		}
+		return nil
+	}
+	str := func(name string) string {
+		if n := d.Section(name); n != nil && n.Kind == ScalarNode {
+			return n.Value
+		}
+		return ""
+	}
+	t.AWSTemplateFormatVersion = str("AWSTemplateFormatVersion")
+	t.Transform = str("Transform")
+	t.Description = str("Description")
+	t.Metadata = sec("Metadata")
+	t.Parameters = sec("Parameters")
+	t.Mappings = sec("Mappings")
+	t.Conditions = sec("Conditions")
+	t.Resources = sec("Resources")
+	t.Outputs = sec("Outputs")
+	return t
+}
+
+// NewScalar returns a string scalar Node.
+func NewScalar(v string) *Node {
+	return &Node{Kind: ScalarNode, Value: v, Tag: "!!str"}
+}
+
+// NewMap returns an empty map Node.
+func NewMap() *Node {
+	return &Node{Kind: MapNode, Map: map[string]*Node{}}
+}
+
+// Get returns the value of key in a map Node, or nil.
+func (n *Node) Get(key string) *Node {
+	if n == nil || n.Kind != MapNode {
+		return nil
+	}
+	return n.Map[key]
+}
+
+// Set sets key to v in a map Node, appending the key if it is new.
+func (n *Node) Set(key string, v *Node) {
+	if n.Map == nil {
+		n.Map = map[string]*Node{}
+	}
+	if _, ok := n.Map[key]; !ok {
+		n.Keys = append(n.Keys, key)
+	}
+	n.Map[key] = v
+}
+
+// Delete removes key from a map Node.
+func (n *Node) Delete(key string) {
+	if n == nil || n.Kind != MapNode {
+		return
+	}
+	if _, ok := n.Map[key]; !ok {
+		return
+	}
+	delete(n.Map, key)
+	for i, k := range n.Keys {
+		if k == key {
+			n.Keys = append(n.Keys[:i], n.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Walk calls fn for n and every node below it, depth first. The path holds
+// the map keys and list indexes leading to each node; a function's argument
+// has the function name in its path. Returning false from fn skips the
+// children of that node.
+func (n *Node) Walk(fn func(path []string, n *Node) bool) {
+	n.walk(nil, fn)
+}
+
+func (n *Node) walk(path []string, fn func([]string, *Node) bool) {
+	if n == nil || !fn(path, n) {
+		return
+	}
+	switch n.Kind {
+	case MapNode:
+		for _, k := range n.Keys {
+			n.Map[k].walk(append(path[:len(path):len(path)], k), fn)
+		}
+	case ListNode:
+		for i, el := range n.List {
+			el.walk(append(path[:len(path):len(path)], fmt.Sprint(i)), fn)
+		}
+	case FuncNode:
+		n.Arg.walk(append(path[:len(path):len(path)], n.Func), fn)
+	}
+}
+
+// Clone returns a deep copy of n.
+func (n *Node) Clone() *Node {
+	if n == nil {
+		return nil
+	}
+	c := *n
+	if n.Map != nil {
+		c.Keys = append([]string{}, n.Keys...)
+		c.Map = map[string]*Node{}
+		for k, v := range n.Map {
+			c.Map[k] = v.Clone()
+		}
+	}
+	if n.List != nil {
+		c.List = make([]*Node, len(n.List))
+		for i, el := range n.List {
+			c.List[i] = el.Clone()
+		}
+	}
+	c.Arg = n.Arg.Clone()
+	return &c
+}
+
+// Interface returns n as plain go values. Maps are map[string]interface{},
+// lists are []interface{} and functions are written in the long form.
+func (n *Node) Interface() interface{} {
+	if n == nil {
+		return nil
+	}
+	switch n.Kind {
+	case MapNode:
+		m := map[string]interface{}{}
+		for _, k := range n.Keys {
+			m[k] = n.Map[k].Interface()
+		}
+		return m
+	case ListNode:
+		l := []interface{}{}
+		for _, el := range n.List {
+			l = append(l, el.Interface())
+		}
+		return l
+	case FuncNode:
+		return map[string]interface{}{n.Func: n.longArg().Interface()}
+	}
+	var v interface{}
+	if err := n.yaml().Decode(&v); err != nil {
+		return n.Value
+	}
+	return v
+}
+
+// YAML encodes n as a yaml document.
+func (n *Node) YAML() ([]byte, error) {
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{n.yaml()}}
+	buf := bytes.NewBufferString("")
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("cant marshal template to yaml: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// JSON encodes n as indented json. Short form functions are written in
+// the long form as json has no equivalent.
+func (n *Node) JSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	if err := n.json(&buf, ""); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// fromYAML converts a yaml.v3 node into a Node.
+func fromYAML(yn *yaml.Node) (*Node, error) {
+	for yn.Kind == yaml.AliasNode {
+		yn = yn.Alias
+	}
+	n := &Node{
+		Line:     yn.Line,
+		Column:   yn.Column,
+		style:    yn.Style &^ yaml.TaggedStyle,
+		comments: [3]string{yn.HeadComment, yn.LineComment, yn.FootComment},
+	}
+
+	if fn, ok := shortFuncs[yn.Tag]; ok {
+		argn := *yn
+		argn.Tag = ""
+		argn.HeadComment, argn.LineComment, argn.FootComment = "", "", ""
+		arg, err := fromYAML(&argn)
+		if err != nil {
+			return nil, err
+		}
+		if arg.Kind == ScalarNode {
+			arg.Tag = "!!str"
+		}
+		n.Kind, n.Func, n.Arg, n.Short = FuncNode, fn, arg, true
+		return n, nil
+	}
+
+	switch yn.Kind {
+	case yaml.ScalarNode:
+		n.Kind = ScalarNode
+		n.Value = yn.Value
+		n.Tag = yn.ShortTag()
+	case yaml.SequenceNode:
+		n.Kind = ListNode
+		n.Tag = customTag(yn)
+		n.List = []*Node{}
+		for _, el := range yn.Content {
+			c, err := fromYAML(el)
+			if err != nil {
+				return nil, err
+			}
+			n.List = append(n.List, c)
+		}
+	case yaml.MappingNode:
+		n.Kind = MapNode
+		n.Tag = customTag(yn)
+		n.Map = map[string]*Node{}
+		for i := 0; i+1 < len(yn.Content); i += 2 {
+			k := yn.Content[i]
+			v, err := fromYAML(yn.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			v.keyStyle = k.Style
+			v.keyComments = [3]string{k.HeadComment, k.LineComment, k.FootComment}
+			n.Set(k.Value, v)
+		}
+		if len(n.Keys) == 1 && isLongFunc(n.Keys[0], n.Map[n.Keys[0]]) {
+			k := n.Keys[0]
+			n.Kind, n.Func, n.Arg = FuncNode, k, n.Map[k]
+			n.Keys, n.Map = nil, nil
+		}
+	default:
+		return nil, fmt.Errorf("line %d: unsupported yaml node", yn.Line)
+	}
+	return n, nil
+}
+
+// customTag returns the tag of a list or map node if it's one cloudformation
+// or a transform might know but sfm doesn't, so it can be written back out.
+func customTag(yn *yaml.Node) string {
+	if strings.HasPrefix(yn.Tag, "!") && !strings.HasPrefix(yn.Tag, "!!") {
+		return yn.Tag
+	}
+	return ""
+}
+
+// isLongFunc reports whether a single key map is an intrinsic function in
+// the long form. A map with only a Condition key is a condition function
+// when its value is a condition name.
+func isLongFunc(k string, v *Node) bool {
+	switch {
+	case k == IncludeKey:
+		return false
+	case k == "Ref", strings.HasPrefix(k, "Fn::"):
+		return true
+	case k == "Condition":
+		return v.Kind == ScalarNode
+	}
+	return false
+}
+
+// longArg returns the argument of a function in the form used by its long
+// form, ie. !GetAtt a.b becomes [a, b].
+func (n *Node) longArg() *Node {
+	if n.Func == "Fn::GetAtt" && n.Arg.Kind == ScalarNode {
+		res, att, _ := strings.Cut(n.Arg.Value, ".")
+		return &Node{Kind: ListNode, List: []*Node{NewScalar(res), NewScalar(att)}}
+	}
+	return n.Arg
+}
+
+// yaml converts n back into a yaml.v3 node.
+func (n *Node) yaml() *yaml.Node {
+	yn := &yaml.Node{
+		Style:       n.style,
+		HeadComment: n.comments[0],
+		LineComment: n.comments[1],
+		FootComment: n.comments[2],
+	}
+	switch n.Kind {
+	case ScalarNode:
+		yn.Kind, yn.Tag, yn.Value = yaml.ScalarNode, n.Tag, n.Value
+	case ListNode:
+		yn.Kind, yn.Tag = yaml.SequenceNode, n.Tag
+		for _, el := range n.List {
+			yn.Content = append(yn.Content, el.yaml())
+		}
+	case MapNode:
+		yn.Kind, yn.Tag = yaml.MappingNode, n.Tag
+		for _, k := range n.Keys {
+			v := n.Map[k]
+			kn := &yaml.Node{
+				Kind:        yaml.ScalarNode,
+				Tag:         "!!str",
+				Value:       k,
+				Style:       v.keyStyle,
+				HeadComment: v.keyComments[0],
+				LineComment: v.keyComments[1],
+				FootComment: v.keyComments[2],
+			}
+			yn.Content = append(yn.Content, kn, v.yaml())
+		}
+	case FuncNode:
+		if n.Short {
+			arg := n.Arg.yaml()
+			arg.Tag = "!" + strings.TrimPrefix(n.Func, "Fn::")
+			arg.Style |= n.style
+			arg.HeadComment, arg.LineComment, arg.FootComment = yn.HeadComment, yn.LineComment, yn.FootComment
+			return arg
+		}
+		yn.Kind = yaml.MappingNode
+		kn := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: n.Func, Style: n.Arg.keyStyle}
+		yn.Content = []*yaml.Node{kn, n.Arg.yaml()}
+	}
+	return yn
+}
+
+// json writes n to buf as indented json.
+func (n *Node) json(buf *bytes.Buffer, indent string) error {
+	in := indent + "  "
+	switch n.Kind {
+	case ScalarNode:
+		return n.jsonScalar(buf)
+	case ListNode:
+		if len(n.List) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for i, el := range n.List {
+			buf.WriteString(in)
+			if err := el.json(buf, in); err != nil {
+				return err
+			}
+			if i < len(n.List)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "]")
+	case MapNode:
+		if len(n.Keys) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for i, k := range n.Keys {
+			buf.WriteString(in)
+			writeJSONString(buf, k)
+			buf.WriteString(": ")
+			if err := n.Map[k].json(buf, in); err != nil {
+				return err
+			}
+			if i < len(n.Keys)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "}")
+	case FuncNode:
+		buf.WriteString("{\n" + in)
+		writeJSONString(buf, n.Func)
+		buf.WriteString(": ")
+		if err := n.longArg().json(buf, in); err != nil {
+			return err
+		}
+		buf.WriteString("\n" + indent + "}")
+	}
+	return nil
+}
+
+func (n *Node) jsonScalar(buf *bytes.Buffer) error {
+	switch n.Tag {
+	case "!!null":
+		buf.WriteString("null")
+		return nil
+	case "!!bool":
+		var b bool
+		if err := n.yaml().Decode(&b); err != nil {
+			return fmt.Errorf("line %d: cant decode bool: %w", n.Line, err)
+		}
+		fmt.Fprint(buf, b)
+		return nil
+	case "!!int", "!!float":
+		if json.Valid([]byte(n.Value)) {
+			buf.WriteString(n.Value)
+			return nil
+		}
+	}
+	writeJSONString(buf, n.Value)
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // Encode appends a newline
+}
+
+func joinComments(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + "\n" + b
+}
@@ -0,0 +1,122 @@
+package sfm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfn "github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cfntyp "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// Summary is what cloudformation reports about a template before a stack is
+// made from it.
+type Summary struct {
+	Desc          string
+	Caps          []string
+	CapsReason    string
+	Transforms    []string
+	Params        []SummaryParam
+	ResourceTypes []string
+	Version       string
+
+	// Identifiers are the properties which identify each resource type when
+	// an existing resource is imported.
+	Identifiers map[string][]string
+}
+
+// SummaryParam is a parameter declared by a template.
+type SummaryParam struct {
+	Name    string
+	Type    string
+	Default string
+	Desc    string
+	NoEcho  bool
+}
+
+// Validate checks the template with ValidateTemplate and returns the
+// template's summary. The template is read from url when it is set, which
+// cloudformation requires for bodies larger than 51,200 bytes.
+func (h Handle) Validate(body, url string) (Summary, error) {
+	vi := &cfn.ValidateTemplateInput{}
+	si := &cfn.GetTemplateSummaryInput{}
+	if url != "" {
+		vi.TemplateURL, si.TemplateURL = aws.String(url), aws.String(url)
+	} else {
+		vi.TemplateBody, si.TemplateBody = aws.String(body), aws.String(body)
+	}
+
+	if _, err := h.CFNcli.ValidateTemplate(context.Background(), vi); err != nil {
+		return Summary{}, fmt.Errorf("cant validate template: %w", err)
+	}
+	o, err := h.CFNcli.GetTemplateSummary(context.Background(), si)
+	if err != nil {
+		return Summary{}, fmt.Errorf("cant get template summary: %w", err)
+	}
+
+	sum := Summary{
+		Desc:          str(o.Description),
+		CapsReason:    str(o.CapabilitiesReason),
+		Transforms:    o.DeclaredTransforms,
+		ResourceTypes: o.ResourceTypes,
+		Version:       str(o.Version),
+		Identifiers:   map[string][]string{},
+	}
+	for _, c := range o.Capabilities {
+		sum.Caps = append(sum.Caps, string(c))
+	}
+	for _, ri := range o.ResourceIdentifierSummaries {
+		sum.Identifiers[str(ri.ResourceType)] = ri.ResourceIdentifiers
+	}
+	for _, p := range o.Parameters {
+		sum.Params = append(sum.Params, SummaryParam{
+			Name:    str(p.ParameterKey),
+			Type:    str(p.ParameterType),
+			Default: str(p.DefaultValue),
+			Desc:    str(p.Description),
+			NoEcho:  aws.ToBool(p.NoEcho),
+		})
+	}
+	return sum, nil
+}
+
+// RequiredCaps returns the capabilities a stack made from the template must
+// be given. Transforms need CAPABILITY_AUTO_EXPAND. The summary can't see
+// into nested stacks, so templates with nested stacks get the defaults.
+func (sum Summary) RequiredCaps() []string {
+	for _, t := range sum.ResourceTypes {
+		if t == "AWS::CloudFormation::Stack" {
+			return capsToStrings(defaultCaps)
+		}
+	}
+	caps := append([]string{}, sum.Caps...)
+	auto := string(cfntyp.CapabilityCapabilityAutoExpand)
+	if len(sum.Transforms) > 0 && !contains(caps, auto) {
+		caps = append(caps, auto)
+	}
+	return caps
+}
+
+// caps returns the capabilities required by the stack's template, or the
+// defaults if the template can't be summarised, along with the stack's Caps.
+func (h Handle) caps(s Stack) []cfntyp.Capability {
+	req := capsToStrings(defaultCaps)
+	if sum, err := h.Validate(s.TemplateBody, s.TemplateURL); err == nil {
+		req = sum.RequiredCaps()
+	}
+	var caps []cfntyp.Capability
+	for _, c := range append(req, s.Caps...) {
+		if !contains(capsToStrings(caps), c) {
+			caps = append(caps, cfntyp.Capability(c))
+		}
+	}
+	return caps
+}
+
+func capsToStrings(caps []cfntyp.Capability) []string {
+	ss := []string{}
+	for _, c := range caps {
+		ss = append(ss, string(c))
+	}
+	return ss
+}
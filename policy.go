@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+)
+
+func (s stack) policy(args []string) int {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "policy requires an action (get, set or clear) and the name of the stack")
+		fmt.Print(usagePolicy)
+		return 64
+	}
+	action, stack := args[0], args[1]
+	h := sfm.Handle{CFNcli: s.cli}
+
+	switch action {
+	case "get":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "policy get accepts one argument, the name of the stack")
+			return 64
+		}
+		p, err := h.GetPolicy(stack)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		if p == "" {
+			fmt.Fprintf(os.Stderr, "stack '%s' has no policy\n", stack)
+			return 0
+		}
+		buf := bytes.Buffer{}
+		if err := json.Indent(&buf, []byte(p), "", "  "); err != nil {
+			fmt.Println(p)
+			return 0
+		}
+		fmt.Println(buf.String())
+	case "set":
+		fn := ""
+		if len(args) > 2 {
+			fn = args[2]
+		}
+		if fn == "" && !havePipe() {
+			fmt.Fprintln(os.Stderr, "policy set requires a policy file or a policy on stdin")
+			fmt.Print(usagePolicy)
+			return 64
+		}
+		p, err := readPolicy(fn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 66
+		}
+		if err := h.SetPolicy(stack, p); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	case "clear":
+		if err := h.ClearPolicy(stack); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown policy action '%s'\n", action)
+		fmt.Print(usagePolicy)
+		return 64
+	}
+
+	if isPiped() && action != "get" {
+		fmt.Println(stack)
+	}
+	return 0
+}
+
+// readPolicy returns the stack policy in the file fn, or on stdin if fn is
+// empty. The policy must be json.
+func readPolicy(fn string) (string, error) {
+	var b []byte
+	var err error
+	if fn == "" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(filepath.Clean(fn))
+	}
+	if err != nil {
+		return "", fmt.Errorf("cant read policy: %w", err)
+	}
+	if !json.Valid(b) {
+		return "", fmt.Errorf("policy '%s' is not valid json", fn)
+	}
+	return string(b), nil
+}
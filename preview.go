@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+)
+
+const (
+	previewTag = "sfm:preview" // the suffix of a preview stack
+	previewTTL = "7d"          // when preview stacks expire, unless -ttl says otherwise
+)
+
+var notNameChars = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// previewSuffix returns the suffix as it can be used in a stack name, eg.
+// the branch feature/JIRA-12_x becomes feature-JIRA-12-x.
+func previewSuffix(suffix string) string {
+	return strings.Trim(notNameChars.ReplaceAllString(suffix, "-"), "-")
+}
+
+// previewTemplate rewrites the template of the stack for a preview copy
+// with the suffix, see sfm.Doc.Preview. Names are worked out as they would
+// be for the stack itself, not the copy, so imports of the original's
+// exports match the copy's.
+func (s stack) previewTemplate(b []byte, name, suffix string, params map[string]string) ([]byte, error) {
+	d, err := sfm.ParseTemplate(b)
+	if err != nil {
+		return nil, err
+	}
+	exported := map[string]bool{}
+	ee, err := sfm.Handle{CFNcli: s.cli}.Exports("*-" + suffix)
+	if err != nil {
+		fmt.Fprintf(s.stderr(), "WARN %v; imports are not rewritten for the preview\n", err)
+	}
+	for _, e := range ee {
+		exported[e.Name] = true
+	}
+
+	vars := d.Vars(name, s.cfg.Region, params)
+	for _, i := range d.Preview(suffix, vars, func(e string) bool { return exported[e] }) {
+		fmt.Fprintf(s.stderr(), "importing '%s-%s' instead of '%s'\n", i, suffix, i)
+	}
+	b, err = d.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("cant marshal template: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+)
+
+func (s stack) protect(args []string) int {
+	if len(args) != 2 || (args[0] != "on" && args[0] != "off") {
+		fmt.Fprintln(os.Stderr, "protect accepts two positional arguments, 'on' or 'off' and the name of the stack")
+		fmt.Print(usageProtect)
+		return 64
+	}
+	stack := args[1]
+
+	h := sfm.Handle{CFNcli: s.cli}
+	if err := h.Protect(stack, args[0] == "on"); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	if isPiped() {
+		fmt.Println(stack)
+	}
+	return 0
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+)
+
+// the tags reap reads to work out when a stack expires
+const (
+	expiresTag = "sfm:expires" // a time, eg. 2026-11-01T00:00Z
+	ttlTag     = "sfm:ttl"     // a duration after the stack was created, eg. 72h
+)
+
+func (s stack) reap(args []string, dryRun, force bool, wait string, nowait bool) int {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "reap accepts one positional argument, a glob")
+		fmt.Print(usageReap)
+		return 64
+	}
+	glob := "*"
+	if len(args) > 0 {
+		glob = args[0]
+	}
+	dots := wait == "dots"
+	events := wait == "events" || (!nowait && !dots)
+
+	h := sfm.Handle{CFNcli: s.cli}
+	ss, err := h.List(glob)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cant list stacks: %v\n", err)
+		return 1
+	}
+
+	now := time.Now().UTC()
+	expires := map[string]time.Time{}
+	outcome := map[string]string{}
+	names := []string{}
+	for _, x := range ss {
+		exp, ok, err := expiry(x)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARN stack '%s': %v\n", x.Name, err)
+			continue
+		}
+		if !ok || exp.After(now) {
+			continue
+		}
+		expires[x.Name] = exp
+		switch {
+		case x.TermProc:
+			outcome[x.Name] = "protected"
+		case status(types.StackStatus(x.Status)) == "prog":
+			outcome[x.Name] = "busy"
+		default:
+			names = append(names, x.Name)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) > 0 {
+		waves, blocked, err := deleteOrder(h, names, s.stderr())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		for name, why := range blocked {
+			outcome[name] = "blocked: " + why
+		}
+		for i, wave := range waves {
+			if dryRun {
+				for _, name := range wave {
+					outcome[name] = "would delete"
+				}
+				continue
+			}
+			failed := s.remvWave(wave, false, force, true, dots, events)
+			for _, name := range wave {
+				outcome[name] = "deleted"
+				if slices.Contains(failed, name) {
+					outcome[name] = "failed"
+				}
+			}
+			if len(failed) > 0 {
+				// the stacks left export to those which failed
+				for _, w := range waves[i+1:] {
+					for _, name := range w {
+						outcome[name] = "skipped"
+					}
+				}
+				break
+			}
+		}
+	}
+
+	all := []string{}
+	count := map[string]int{}
+	for name, o := range outcome {
+		all = append(all, name)
+		o, _, _ = strings.Cut(o, ":")
+		count[o]++
+	}
+	sort.Strings(all)
+	for _, name := range all {
+		fmt.Printf("%s\t%s\t%s\n", name, expires[name].Format(time.RFC3339), outcome[name])
+	}
+	fmt.Fprintf(os.Stderr, "%d stacks checked, %d expired: %d deleted, %d would delete, %d failed, %d skipped, %d blocked, %d protected, %d busy\n",
+		len(ss), len(all), count["deleted"], count["would delete"], count["failed"], count["skipped"], count["blocked"], count["protected"], count["busy"])
+	if count["failed"] > 0 {
+		return 1
+	}
+	return 0
+}
+
+// expiry returns when the stack expires, from its sfm:expires tag or else
+// its sfm:ttl tag and creation time. ok is false if it has neither.
+func expiry(x sfm.Stack) (time.Time, bool, error) {
+	if v, ok := x.Tags[expiresTag]; ok {
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02T15:04", "2006-01-02"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true, nil
+			}
+		}
+		return time.Time{}, false, fmt.Errorf("cant parse %s tag '%s', expected a time like 2026-11-01T00:00Z", expiresTag, v)
+	}
+	if v, ok := x.Tags[ttlTag]; ok {
+		d, err := parseTTL(v)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("cant parse %s tag: %w", ttlTag, err)
+		}
+		return x.Created.Add(d), true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+// parseTTL parses a go duration, eg. 90m or 48h, or a number of days, eg. 7d.
+func parseTTL(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("bad ttl '%s', expected eg. 48h or 7d", v)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("bad ttl '%s', expected eg. 48h or 7d", v)
+	}
+	return d, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// regionList returns the regions in -r, a comma separated list or 'all',
+// which asks ec2 for the regions enabled in the account.
+func regionList(cfg aws.Config, v string) ([]string, error) {
+	if v != "all" {
+		rr := []string{}
+		for _, r := range strings.Split(v, ",") {
+			// the same region twice would run the same stack twice at once
+			if r = strings.TrimSpace(r); r != "" && !slices.Contains(rr, r) {
+				rr = append(rr, r)
+			}
+		}
+		return rr, nil
+	}
+
+	if cfg.Region == "" {
+		cfg = cfg.Copy()
+		cfg.Region = "us-east-1"
+	}
+	o, err := ec2.NewFromConfig(cfg).DescribeRegions(context.Background(), &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("cant list regions: %w", err)
+	}
+	rr := []string{}
+	for _, r := range o.Regions {
+		rr = append(rr, aws.ToString(r.RegionName))
+	}
+	sort.Strings(rr)
+	return rr, nil
+}
+
+// each runs f in every region at once, with its output prefixed with the
+// region, and returns the first non-zero exit code in region order. With
+// one region f runs in it unprefixed, and with none in s as it is.
+func (s stack) each(regions []string, f func(stack) int) int {
+	switch len(regions) {
+	case 0:
+		return f(s)
+	case 1:
+		return f(s.inRegion(regions[0]))
+	}
+	width := 0
+	for _, r := range regions {
+		if len(r) > width {
+			width = len(r)
+		}
+	}
+	mu := &sync.Mutex{}
+	codes := make([]int, len(regions))
+	wg := sync.WaitGroup{}
+	for i, r := range regions {
+		x := s.inRegion(r)
+		prefix := fmt.Sprintf("%-*s | ", width, r)
+		out := &prefixWriter{mu: mu, w: s.stdout(), prefix: prefix}
+		err := &prefixWriter{mu: mu, w: s.stderr(), prefix: prefix}
+		x.out, x.err = out, err
+		wg.Add(1)
+		go func(i int, x stack) {
+			defer wg.Done()
+			codes[i] = f(x)
+			out.Flush()
+			err.Flush()
+		}(i, x)
+	}
+	wg.Wait()
+
+	for _, c := range codes {
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
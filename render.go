@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+	"gopkg.in/yaml.v3"
+)
+
+func (s stack) render(args []string, tmpl string) int {
+	inPipe := havePipe()
+	if tmpl == "" && !inPipe {
+		fmt.Fprintln(os.Stderr, "no template flag supplied and no pipe on stdin")
+		fmt.Print(usageRender)
+		return 64
+	}
+
+	b, err := s.readTemplate(tmpl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if tmpl != "" && inPipe {
+		fmt.Fprintln(os.Stderr, "WARN using template file; ignoring stdin")
+	}
+
+	values, err := loadValues(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cant load values: %v\n", err)
+		return 66
+	}
+	out, err := renderTemplate(tmpl, b, values)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 65
+	}
+	out, err = resolveIncludes(tmpl, out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 65
+	}
+	fmt.Print(string(out))
+	return 0
+}
+
+// loadValues reads yaml or json values files in order, later files are
+// deep-merged over earlier ones.
+func loadValues(files []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, fn := range files {
+		bb, err := os.ReadFile(filepath.Clean(fn))
+		if err != nil {
+			return nil, fmt.Errorf("can't read file %s: %w", fn, err)
+		}
+		m := map[string]interface{}{}
+		if err := yaml.Unmarshal(bb, &m); err != nil {
+			return nil, fmt.Errorf("can't unmarshal file %s: %w", fn, err)
+		}
+		mergeValues(values, m)
+	}
+	return values, nil
+}
+
+func mergeValues(dst, src map[string]interface{}) {
+	for k, v := range src {
+		sm, sok := v.(map[string]interface{})
+		dm, dok := dst[k].(map[string]interface{})
+		if sok && dok {
+			mergeValues(dm, sm)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// resolveIncludes returns body with any Fn::sfm::Include directives
+// replaced by the fragments they name. A body without directives is returned
+// unchanged.
+func resolveIncludes(name string, body []byte) ([]byte, error) {
+	if !bytes.Contains(body, []byte(sfm.IncludeKey)) {
+		return body, nil
+	}
+	d, err := sfm.ParseTemplate(body)
+	if err != nil {
+		return nil, fmt.Errorf("cant resolve includes: %w", err)
+	}
+	if strings.HasPrefix(name, "s3://") {
+		name = ""
+	}
+	if err := d.ResolveIncludes(name); err != nil {
+		return nil, err
+	}
+	return d.Marshal()
+}
+
+// dynamicRef starts a cloudformation dynamic reference, eg.
+// {{resolve:ssm:name}}, which text/template would take for an action.
+// renderTemplate swaps it for dynamicRefHold while rendering.
+const (
+	dynamicRef     = "{{resolve:"
+	dynamicRefHold = "\x00sfm:resolve\x00"
+)
+
+// renderTemplate runs body through text/template with the supplied values as
+// dot. Referencing a missing key is an error. Dynamic references are passed
+// through as they are.
+func renderTemplate(name string, body []byte, values map[string]interface{}) ([]byte, error) {
+	if name == "" {
+		name = "stdin"
+	}
+	body = bytes.ReplaceAll(body, []byte(dynamicRef), []byte(dynamicRefHold))
+	t, err := template.New(name).Funcs(renderFuncs).Option("missingkey=error").Parse(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("cant parse template for rendering: %w", err)
+	}
+	buf := bytes.Buffer{}
+	if err := t.Execute(&buf, values); err != nil {
+		return nil, fmt.Errorf("cant render template: %w", err)
+	}
+	return bytes.ReplaceAll(buf.Bytes(), []byte(dynamicRefHold), []byte(dynamicRef)), nil
+}
+
+// renderFuncs is a small subset of the sprig helpers, argument order follows
+// sprig so values can be piped in as the last argument.
+var renderFuncs = template.FuncMap{
+	// defaults and flow
+	"default": func(d interface{}, v ...interface{}) interface{} {
+		if len(v) == 0 || empty(v[0]) {
+			return d
+		}
+		return v[0]
+	},
+	"empty": empty,
+	"coalesce": func(vv ...interface{}) interface{} {
+		for _, v := range vv {
+			if !empty(v) {
+				return v
+			}
+		}
+		return nil
+	},
+	"ternary": func(t, f interface{}, c bool) interface{} {
+		if c {
+			return t
+		}
+		return f
+	},
+	"required": func(msg string, v interface{}) (interface{}, error) {
+		if empty(v) {
+			return nil, errors.New(msg)
+		}
+		return v, nil
+	},
+	"fail": func(msg string) (string, error) { return "", errors.New(msg) },
+
+	// strings
+	"quote":      func(v interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(v)) },
+	"squote":     func(v interface{}) string { return "'" + fmt.Sprint(v) + "'" },
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"title":      title,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(p, s string) string { return strings.TrimPrefix(s, p) },
+	"trimSuffix": func(x, s string) string { return strings.TrimSuffix(s, x) },
+	"replace":    func(o, n, s string) string { return strings.ReplaceAll(s, o, n) },
+	"contains":   func(sub, s string) bool { return strings.Contains(s, sub) },
+	"hasPrefix":  func(p, s string) bool { return strings.HasPrefix(s, p) },
+	"hasSuffix":  func(x, s string) bool { return strings.HasSuffix(s, x) },
+	"splitList":  func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":       join,
+	"indent":     indent,
+	"nindent":    func(n int, s string) string { return "\n" + indent(n, s) },
+	"b64enc":     func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec": func(s string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(s)
+		return string(b), err
+	},
+	"env": os.Getenv,
+
+	// collections
+	"list": func(vv ...interface{}) []interface{} { return vv },
+	"dict": func(kv ...interface{}) (map[string]interface{}, error) {
+		if len(kv)%2 != 0 {
+			return nil, errors.New("dict requires an even number of arguments")
+		}
+		m := map[string]interface{}{}
+		for i := 0; i < len(kv); i += 2 {
+			m[fmt.Sprint(kv[i])] = kv[i+1]
+		}
+		return m, nil
+	},
+	"keys": func(m map[string]interface{}) []string {
+		kk := []string{}
+		for k := range m {
+			kk = append(kk, k)
+		}
+		sort.Strings(kk)
+		return kk
+	},
+	"hasKey": func(m map[string]interface{}, k string) bool { _, ok := m[k]; return ok },
+	"until": func(n int) []int {
+		ii := make([]int, 0, n)
+		for i := 0; i < n; i++ {
+			ii = append(ii, i)
+		}
+		return ii
+	},
+
+	// maths
+	"add": func(a, b int) int { return a + b },
+	"sub": func(a, b int) int { return a - b },
+	"mul": func(a, b int) int { return a * b },
+	"div": func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a / b, nil
+	},
+	"mod": func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a % b, nil
+	},
+
+	// encoding
+	"toJson": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"toYaml": func(v interface{}) (string, error) {
+		b, err := yaml.Marshal(v)
+		return strings.TrimSuffix(string(b), "\n"), err
+	},
+}
+
+func empty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
+
+func join(sep string, v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return fmt.Sprint(v)
+	}
+	ss := []string{}
+	for i := 0; i < rv.Len(); i++ {
+		ss = append(ss, fmt.Sprint(rv.Index(i).Interface()))
+	}
+	return strings.Join(ss, sep)
+}
+
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+func title(s string) string {
+	ww := strings.Fields(s)
+	for i, w := range ww {
+		r := []rune(w)
+		ww[i] = strings.ToUpper(string(r[0])) + string(r[1:])
+	}
+	return strings.Join(ww, " ")
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+)
+
+// expandStacks returns the stack names, with globs replaced by the names of
+// the stacks which match them.
+func expandStacks(h sfm.Handle, args []string) ([]string, error) {
+	names := []string{}
+	for _, a := range args {
+		if !isGlob(a) {
+			if !slices.Contains(names, a) {
+				names = append(names, a)
+			}
+			continue
+		}
+		ss, err := h.List(a)
+		if err != nil {
+			return nil, fmt.Errorf("cant list stacks: %w", err)
+		}
+		for _, x := range ss {
+			if x.Status != "DELETE_COMPLETE" && !slices.Contains(names, x.Name) {
+				names = append(names, x.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+func isGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// deleteOrder sorts the stacks into waves to delete them in. A stack is
+// deleted after the stacks which import its exports, so each wave only
+// exports to the waves before it. Stacks which can't be deleted, as stacks
+// which aren't being deleted import from them, are left out of the waves
+// and returned with the reason; cloudformation would only find out part way
+// through the delete. Warnings go to w.
+func deleteOrder(h sfm.Handle, names []string, w io.Writer) ([][]string, map[string]string, error) {
+	// only the exports of the stacks being deleted matter
+	dd := []sfm.Dependency{}
+	for _, name := range names {
+		d, err := h.Dependencies(name)
+		if err != nil {
+			if len(names) > 1 {
+				return nil, nil, fmt.Errorf("cant work out the order to delete the stacks in: %w", err)
+			}
+			fmt.Fprintf(w, "WARN cant check the stack's exports: %v\n", err)
+		}
+		dd = append(dd, d...)
+	}
+
+	deps := map[string][]string{} // stack: stacks to delete first
+	for _, name := range names {
+		deps[name] = nil
+	}
+	inUse := map[string]map[string][]string{} // stack: export: importers not being deleted
+	for _, d := range dd {
+		if _, ok := deps[d.Exporter]; !ok {
+			continue
+		}
+		if _, ok := deps[d.Stack]; ok {
+			if !slices.Contains(deps[d.Exporter], d.Stack) {
+				deps[d.Exporter] = append(deps[d.Exporter], d.Stack)
+			}
+			continue
+		}
+		if inUse[d.Exporter] == nil {
+			inUse[d.Exporter] = map[string][]string{}
+		}
+		inUse[d.Exporter][d.Export] = append(inUse[d.Exporter][d.Export], d.Stack)
+	}
+
+	blocked := map[string]string{}
+	for name, ee := range inUse {
+		rr := []string{}
+		for e, ss := range ee {
+			rr = append(rr, fmt.Sprintf("export '%s' is imported by %s", e, strings.Join(ss, ", ")))
+		}
+		sort.Strings(rr)
+		blocked[name] = strings.Join(rr, "; ")
+	}
+	// stacks which blocked stacks import from are blocked too
+	for more := true; more; {
+		more = false
+		for name, dd := range deps {
+			if _, ok := blocked[name]; ok {
+				continue
+			}
+			for _, dep := range dd {
+				if _, ok := blocked[dep]; ok {
+					blocked[name] = fmt.Sprintf("'%s' imports its exports and can't be deleted", dep)
+					more = true
+					break
+				}
+			}
+		}
+	}
+	for name := range blocked {
+		delete(deps, name)
+	}
+
+	waves, err := order(deps)
+	return waves, blocked, err
+}
+
+// remvWave deletes the stacks at once and returns the names of those which
+// failed. Their output is prefixed with the stack name when there are
+// several.
+func (s stack) remvWave(wave []string, unprotect, force, block, dots, events bool) []string {
+	width := 0
+	for _, name := range wave {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	mu := &sync.Mutex{}
+	errs := make([]error, len(wave))
+	wg := sync.WaitGroup{}
+	for i, name := range wave {
+		x := s
+		var out, err *prefixWriter
+		if len(wave) > 1 {
+			prefix := fmt.Sprintf("%-*s | ", width, name)
+			out = &prefixWriter{mu: mu, w: s.stdout(), prefix: prefix}
+			err = &prefixWriter{mu: mu, w: s.stderr(), prefix: prefix}
+			x.out, x.err = out, err
+		}
+		wg.Add(1)
+		go func(i int, name string, x stack) {
+			defer wg.Done()
+			if errs[i] = x.remvStack(name, unprotect, force, block, dots, events); errs[i] != nil {
+				fmt.Fprintf(x.stderr(), "%v\n", errs[i])
+			}
+			if out != nil {
+				out.Flush()
+				err.Flush()
+			}
+		}(i, name, x)
+	}
+	wg.Wait()
+
+	failed := []string{}
+	for i, name := range wave {
+		switch {
+		case errs[i] != nil:
+			failed = append(failed, name)
+		case isPiped():
+			fmt.Fprintln(s.stdout(), name)
+		}
+	}
+	return failed
+}
+
+// remvStack deletes a stack, disabling termination protection first if
+// unprotect is set and emptying its buckets if force is set, and blocks
+// until it is gone if block is set.
+func (s stack) remvStack(name string, unprotect, force, block, dots, events bool) error {
+	h := sfm.Handle{CFNcli: s.cli}
+	// a stack which can't be described is left for delete to report on
+	x, err := h.Get(name)
+	if err == nil && x.TermProc {
+		if !unprotect {
+			return fmt.Errorf("stack '%s' has termination protection enabled; not deleting\nuse 'sfm rm -unprotect %s' or 'sfm protect off %s' to allow it", name, name, name)
+		}
+		fmt.Fprintf(s.stderr(), "disabling termination protection on '%s'\n", name)
+		if err := h.Protect(name, false); err != nil {
+			return err
+		}
+	}
+	if err == nil && force {
+		if err := s.emptyBuckets(x); err != nil {
+			return err
+		}
+	}
+
+	if _, err := h.Delete(name); err != nil {
+		return err
+	}
+	if !block {
+		return nil
+	}
+	err = s.block(name, dots, events)
+	if dots || events {
+		fmt.Fprintln(s.stdout()) // OMG GROSS
+	}
+	if err != nil {
+		return fmt.Errorf("error on wait: %w", err)
+	}
+	return nil
+}
+
+// emptyBuckets deletes every object, and every version of every object, in
+// the stack's buckets so cloudformation can delete them. DATA LOSS. Buckets
+// cloudformation keeps, with a DeletionPolicy other than Delete, are left
+// alone.
+func (s stack) emptyBuckets(x sfm.Stack) error {
+	body, err := x.Handle.GetTemplate(x.Name)
+	if err != nil {
+		return err
+	}
+	d, err := sfm.ParseTemplate([]byte(body))
+	if err != nil {
+		return fmt.Errorf("cant parse '%s' template, not emptying its buckets: %w", x.Name, err)
+	}
+	mm, err := x.AllResources()
+	if err != nil {
+		return err
+	}
+	cli := s3.NewFromConfig(s.cfg)
+	for _, id := range bucketsToEmpty(d, mm) {
+		fmt.Fprintf(s.stderr(), "emptying bucket '%s' (%s)\n", mm[id]["pid"], id)
+		if err := emptyBucket(cli, mm[id]["pid"]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bucketsToEmpty returns the logical ids of the buckets in the resources
+// which cloudformation deletes with the stack, in order.
+func bucketsToEmpty(d *sfm.Doc, mm map[string]map[string]string) []string {
+	ids := []string{}
+	for id, r := range mm {
+		if r["type"] != "AWS::S3::Bucket" || r["pid"] == "" || r["status"] == "DELETE_COMPLETE" {
+			continue
+		}
+		res := d.Section("Resources").Get(id)
+		if res == nil {
+			continue
+		}
+		if p := res.Get("DeletionPolicy"); p != nil && (p.Kind != sfm.ScalarNode || p.Value != "Delete") {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func emptyBucket(cli *s3.Client, bucket string) error {
+	in := &s3.ListObjectVersionsInput{Bucket: aws.String(bucket)}
+	for {
+		o, err := cli.ListObjectVersions(context.Background(), in)
+		if err != nil {
+			var nsb *s3types.NoSuchBucket
+			if errors.As(err, &nsb) {
+				return nil
+			}
+			return fmt.Errorf("cant list objects in '%s': %w", bucket, err)
+		}
+		ids := []s3types.ObjectIdentifier{}
+		for _, v := range o.Versions {
+			ids = append(ids, s3types.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+		}
+		for _, m := range o.DeleteMarkers {
+			ids = append(ids, s3types.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+		}
+		if len(ids) > 0 {
+			do, err := cli.DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+				Bucket: aws.String(bucket),
+				Delete: &s3types.Delete{Objects: ids, Quiet: aws.Bool(true)},
+			})
+			if err != nil {
+				return fmt.Errorf("cant delete objects in '%s': %w", bucket, err)
+			}
+			if len(do.Errors) > 0 {
+				e := do.Errors[0]
+				return fmt.Errorf("cant delete '%s' in '%s': %s", aws.ToString(e.Key), bucket, aws.ToString(e.Message))
+			}
+		}
+		if !aws.ToBool(o.IsTruncated) {
+			return nil
+		}
+		in.KeyMarker, in.VersionIdMarker = o.NextKeyMarker, o.NextVersionIdMarker
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+)
+
+func TestBucketsToEmpty(t *testing.T) {
+	d, err := sfm.ParseTemplate([]byte(`
+Resources:
+  Logs:
+    Type: AWS::S3::Bucket
+  Scratch:
+    Type: AWS::S3::Bucket
+    DeletionPolicy: Delete
+  Archive:
+    Type: AWS::S3::Bucket
+    DeletionPolicy: Retain
+  Backups:
+    Type: AWS::S3::Bucket
+    DeletionPolicy: Snapshot
+  Assets:
+    Type: AWS::S3::Bucket
+    DeletionPolicy: RetainExceptOnCreate
+  Gone:
+    Type: AWS::S3::Bucket
+  Topic:
+    Type: AWS::SNS::Topic
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket := func(pid, status string) map[string]string {
+		return map[string]string{"type": "AWS::S3::Bucket", "pid": pid, "status": status}
+	}
+	mm := map[string]map[string]string{
+		"Logs":     bucket("logs-1", "CREATE_COMPLETE"),
+		"Scratch":  bucket("scratch-1", "UPDATE_COMPLETE"),
+		"Archive":  bucket("archive-1", "CREATE_COMPLETE"),
+		"Backups":  bucket("backups-1", "CREATE_COMPLETE"),
+		"Assets":   bucket("assets-1", "CREATE_COMPLETE"),
+		"Gone":     bucket("gone-1", "DELETE_COMPLETE"),
+		"Unknown":  bucket("unknown-1", "CREATE_COMPLETE"), // not in the template
+		"Creating": bucket("", "CREATE_IN_PROGRESS"),
+		"Topic":    {"type": "AWS::SNS::Topic", "pid": "arn:aws:sns:topic", "status": "CREATE_COMPLETE"},
+	}
+
+	want := []string{"Logs", "Scratch"}
+	if got := bucketsToEmpty(d, mm); !slices.Equal(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+)
+
+func (s stack) continueRollback(args []string, skip, role, wait string, nowait bool) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "continue-rollback accepts one positional argument, the name of the stack")
+		fmt.Print(usageContinueRollback)
+		return 64
+	}
+	stack := args[0]
+	dots := wait == "dots"
+	events := wait == "events" || (!nowait && !dots)
+
+	h := sfm.Handle{CFNcli: s.cli}
+	x, err := h.Get(stack)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if x.Status != string(types.StackStatusUpdateRollbackFailed) {
+		fmt.Fprintf(os.Stderr, "stack '%s' is %s, not %s\n", stack, x.Status, types.StackStatusUpdateRollbackFailed)
+		return 1
+	}
+
+	if !dots && !events {
+		if _, err := h.ContinueRollback(stack, splitList(skip), role); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if err := s.recoverRollback(stack, splitList(skip), role, dots, events); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	if isPiped() {
+		fmt.Println(stack)
+	}
+	return 0
+}
+
+// recoverRollback continues the rollback of a stack in UPDATE_ROLLBACK_FAILED
+// and blocks until it is UPDATE_ROLLBACK_COMPLETE, which can be updated.
+func (s stack) recoverRollback(name string, skip []string, role string, dots, events bool) error {
+	h := sfm.Handle{CFNcli: s.cli}
+	if _, err := h.ContinueRollback(name, skip, role); err != nil {
+		return err
+	}
+
+	// block treats UPDATE_ROLLBACK_COMPLETE as an error, so check the status
+	berr := s.block(name, dots, events)
+	if dots || events {
+		fmt.Fprintln(s.stdout())
+	}
+	x, err := h.Get(name)
+	if err != nil {
+		return err
+	}
+	if x.Status == string(types.StackStatusUpdateRollbackComplete) {
+		return nil
+	}
+	if x.Status == string(types.StackStatusUpdateRollbackFailed) {
+		s.printFailures(x, string(types.StackStatusUpdateRollbackInProgress))
+	}
+	if berr == nil {
+		berr = fmt.Errorf("stack status is %s", x.Status)
+	}
+	return fmt.Errorf("rollback did not complete: %w", berr)
+}
+
+// printFailures prints the resources which failed since the stack last had
+// the status since, and why, to stderr.
+func (s stack) printFailures(x sfm.Stack, since string) {
+	ee, err := x.Failures(since)
+	if err != nil {
+		fmt.Fprintf(s.stderr(), "cant get failures: %v\n", err)
+		return
+	}
+	for _, e := range ee {
+		fmt.Fprint(s.stderr(), e.Pretty())
+	}
+}
+
+// recreateDelete deletes a stack which failed to create so it can be created
+// again. If the delete fails, the resources which couldn't be deleted are
+// retained and the delete is retried.
+func (s stack) recreateDelete(x sfm.Stack, dots, events bool) error {
+	h := sfm.Handle{CFNcli: s.cli}
+	if _, err := h.Delete(x.Name); err != nil {
+		return err
+	}
+	err := s.block(x.Name, dots, events)
+	if dots || events {
+		fmt.Fprintln(s.stdout())
+	}
+	if err == nil {
+		return nil
+	}
+
+	x, gerr := h.Get(x.Name)
+	if gerr != nil || x.Status != string(types.StackStatusDeleteFailed) {
+		return err
+	}
+	mm, err := x.AllResources()
+	if err != nil {
+		return err
+	}
+	retain := []string{}
+	for id, r := range mm {
+		if r["status"] == string(types.ResourceStatusDeleteFailed) {
+			retain = append(retain, id)
+			fmt.Fprintf(s.stderr(), "retaining %s %s (%s): %s\n", r["type"], id, r["pid"], r["reason"])
+		}
+	}
+	if len(retain) < 1 {
+		return fmt.Errorf("stack is %s", x.Status)
+	}
+	fmt.Fprintln(s.stderr(), "retained resources are not deleted, clean them up by hand")
+	if _, err := h.DeleteRetain(x.Name, retain); err != nil {
+		return err
+	}
+	err = s.block(x.Name, dots, events)
+	if dots || events {
+		fmt.Fprintln(s.stdout())
+	}
+	return err
+}
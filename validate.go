@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/toolsdotgo/sfm/pkg/sfm"
+	"gopkg.in/yaml.v3"
+)
+
+func (s stack) validate(args []string, vFiles []string, encoding string) int {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "validate accepts one positional argument, the template")
+		fmt.Print(usageValidate)
+		return 64
+	}
+	tmpl := ""
+	if len(args) == 1 {
+		tmpl = args[0]
+	}
+	if tmpl == "" && !havePipe() {
+		fmt.Fprintln(os.Stderr, "validate requires a template path or a template on stdin")
+		fmt.Print(usageValidate)
+		return 64
+	}
+
+	b, err := s.readTemplate(tmpl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	useURL := strings.HasPrefix(tmpl, "s3://")
+	if len(vFiles) > 0 {
+		values, err := loadValues(vFiles)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cant load values: %v\n", err)
+			return 66
+		}
+		if b, err = renderTemplate(tmpl, b, values); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 65
+		}
+		useURL = false
+	}
+	ib, err := resolveIncludes(tmpl, b)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 65
+	}
+	if string(ib) != string(b) {
+		b = ib
+		useURL = false
+	}
+
+	url := ""
+	if useURL {
+		url = templateURL(tmpl)
+	} else if len(b) > maxBody {
+		fmt.Fprintf(os.Stderr, "the template is %d bytes, more than the %d cloudformation accepts as a body; upload it, rendered, to s3 and validate the s3:// path\n", len(b), maxBody)
+		return 65
+	}
+	h := sfm.Handle{CFNcli: s.cli}
+	sum, err := h.Validate(string(b), url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 65
+	}
+
+	switch encoding {
+	case "yaml", "yml":
+		b, err := yaml.Marshal(sum)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cant marshal summary to yaml: %v\n", err)
+			return 1
+		}
+		fmt.Print(string(b))
+	case "json":
+		b, err := json.Marshal(sum)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cant marshal summary to json: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(b))
+	case "text":
+		fmts := "Description\t%s\nCapabilities\t%s\nCapabilitiesReason\t%s\nTransforms\t%s\nResourceTypes\t%s\n"
+		fmt.Printf(fmts, sum.Desc, strings.Join(sum.Caps, ", "), sum.CapsReason,
+			strings.Join(sum.Transforms, ", "), strings.Join(sum.ResourceTypes, ", "))
+		for _, p := range sum.Params {
+			def := p.Default
+			if p.NoEcho && def != "" {
+				def = "****"
+			}
+			fmt.Printf("Parameter\t%s\t%s\t%s\n", p.Name, p.Type, def)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown encoding '%s'\n", encoding)
+		return 1
+	}
+	return 0
+}